@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// adminPath 下的接口都需要认证，GET adminPath 返回节点概况；
+	// 修改成员和导入快照等写操作只有在设置了 WithHMAC 或 WithTLS 时才允许
+	adminPath = "_admin/"
+	// adminGroupsPath 列出所有 Group 及其缓存大小
+	adminGroupsPath = "_admin/groups"
+)
+
+// GroupStatus 描述一个 Group 的缓存占用
+type GroupStatus struct {
+	Name      string     `json:"name"`
+	MainCache CacheStats `json:"mainCache"`
+	HotCache  CacheStats `json:"hotCache"`
+}
+
+// NodeStatus 是 GET adminPath 返回的节点概况
+type NodeStatus struct {
+	Self   string        `json:"self"`
+	Groups []GroupStatus `json:"groups"`
+	Peers  []PeerStatus  `json:"peers"`
+}
+
+func groupStatuses(gs []*Group) []GroupStatus {
+	list := make([]GroupStatus, len(gs))
+	for i, g := range gs {
+		list[i] = GroupStatus{
+			Name:      g.name,
+			MainCache: g.mainCache.stats(),
+			HotCache:  g.hotCache.stats(),
+		}
+	}
+	return list
+}
+
+func (p *HTTPPool) serveAdmin(w http.ResponseWriter, r *http.Request, path string) {
+	switch path {
+	case adminPath, strings.TrimSuffix(adminPath, "/"):
+		if allowMethods(w, r, http.MethodGet) {
+			writeJSON(w, NodeStatus{Self: p.self, Groups: groupStatuses(p.registry.List()), Peers: p.Members()})
+		}
+	case adminGroupsPath:
+		if allowMethods(w, r, http.MethodGet) {
+			writeJSON(w, groupStatuses(p.registry.List()))
+		}
+	case adminPeersPath:
+		p.serveAdminPeers(w, r)
+	case adminSnapshotPath:
+		p.serveAdminSnapshot(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allowAdminWrite 在未设置 WithHMAC 或 WithTLS 时拒绝修改节点状态的管理请求，
+// 否则任何能访问端口的人都可以加入自己控制的节点
+func (p *HTTPPool) allowAdminWrite(w http.ResponseWriter) bool {
+	if p.secret == nil && p.tlsConfig == nil {
+		http.Error(w, "admin changes require WithHMAC or WithTLS", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
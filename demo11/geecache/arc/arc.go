@@ -0,0 +1,245 @@
+package arc
+
+import "container/list"
+
+// Cache 实现 ARC (Adaptive Replacement Cache) 淘汰策略：
+// t1 保存只访问过一次的条目，t2 保存多次访问的条目，
+// b1、b2 分别记录从 t1、t2 淘汰的 key，命中 ghost 时据此调整 t1 的目标字节数 p
+type Cache struct {
+	maxBytes  int64
+	p         int64
+	t1, t2    *queue
+	b1, b2    *queue //ghost 队列，只记录 key 和原条目大小，不占用 nbytes
+	OnEvicted func(key string, value Value)
+}
+
+type Value = interface {
+	Len() int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        newQueue(),
+		t2:        newQueue(),
+		b1:        newQueue(),
+		b2:        newQueue(),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if kv, ok := c.t1.remove(key); ok {
+		c.t2.push(kv)
+		return kv.value, true
+	}
+	if kv, ok := c.t2.get(key); ok {
+		return kv.value, true
+	}
+	return
+}
+
+func (c *Cache) Add(key string, value Value) {
+	kv := &entry{key: key, value: value}
+	size := int64(len(key)) + int64(value.Len())
+	b2hit := false
+	switch {
+	case c.t1.contains(key):
+		c.t1.remove(key)
+		c.t2.push(kv)
+	case c.t2.contains(key):
+		c.t2.remove(key)
+		c.t2.push(kv)
+	case c.b1.contains(key):
+		delta := size
+		if c.b1.nbytes > 0 && c.b2.nbytes > c.b1.nbytes {
+			delta = size * c.b2.nbytes / c.b1.nbytes
+		}
+		c.p = min(c.p+delta, c.maxBytes)
+		c.b1.remove(key)
+		c.t2.push(kv)
+	case c.b2.contains(key):
+		delta := size
+		if c.b2.nbytes > 0 && c.b1.nbytes > c.b2.nbytes {
+			delta = size * c.b1.nbytes / c.b2.nbytes
+		}
+		c.p = max(c.p-delta, 0)
+		c.b2.remove(key)
+		c.t2.push(kv)
+		b2hit = true
+	default:
+		c.t1.push(kv)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.Bytes() {
+		c.replace(b2hit)
+	}
+	c.trimGhosts()
+}
+
+func (c *Cache) RemoveOldest() {
+	c.replace(false)
+}
+
+// replace 根据 p 决定从 t1 还是 t2 淘汰最旧的条目，并将其 key 记入对应的 ghost 队列
+func (c *Cache) replace(b2hit bool) {
+	if c.t1.len() > 0 && (c.t1.nbytes > c.p || (b2hit && c.t1.nbytes == c.p) || c.t2.len() == 0) {
+		kv := c.t1.pop()
+		c.b1.push(&entry{key: kv.key, value: ghostValue(kv.value.Len())})
+		c.evicted(kv)
+		return
+	}
+	if kv := c.t2.pop(); kv != nil {
+		c.b2.push(&entry{key: kv.key, value: ghostValue(kv.value.Len())})
+		c.evicted(kv)
+	}
+}
+
+// trimGhosts 保证 t1+b1 不超过 maxBytes，四个队列合计不超过 2*maxBytes
+func (c *Cache) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.b1.len() > 0 && c.t1.nbytes+c.b1.nbytes > c.maxBytes {
+		c.b1.pop()
+	}
+	for c.b2.len() > 0 && c.Bytes()+c.b1.nbytes+c.b2.nbytes > 2*c.maxBytes {
+		c.b2.pop()
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	if kv, ok := c.t1.remove(key); ok {
+		c.evicted(kv)
+	} else if kv, ok := c.t2.remove(key); ok {
+		c.evicted(kv)
+	}
+}
+
+// RemoveIf 删除所有 fn 返回 true 的条目，返回删除的数量
+func (c *Cache) RemoveIf(fn func(key string, value Value) bool) int {
+	n := 0
+	for _, q := range []*queue{c.t1, c.t2} {
+		for _, kv := range q.removeIf(fn) {
+			c.evicted(kv)
+			n++
+		}
+	}
+	return n
+}
+
+// Range 对每个条目调用 fn，fn 返回 false 时停止，不影响条目的顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for _, q := range []*queue{c.t1, c.t2} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// SetMaxBytes 修改字节上限，缩小时立即淘汰超出的条目
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	if c.maxBytes != 0 {
+		c.p = min(c.p, c.maxBytes)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.Bytes() {
+		c.replace(false)
+	}
+	c.trimGhosts()
+}
+
+func (c *Cache) Len() int {
+	return c.t1.len() + c.t2.len()
+}
+
+// Bytes 返回当前占用的字节数，不包括 ghost 队列
+func (c *Cache) Bytes() int64 {
+	return c.t1.nbytes + c.t2.nbytes
+}
+
+// ghostValue 记录被淘汰条目 value 的大小
+type ghostValue int
+
+func (v ghostValue) Len() int { return int(v) }
+
+type entry struct {
+	key   string
+	value Value
+}
+
+// queue 是带字节统计的 LRU 队列，表头为最近访问
+type queue struct {
+	nbytes int64
+	ll     *list.List
+	cache  map[string]*list.Element
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New(), cache: make(map[string]*list.Element)}
+}
+
+func (q *queue) len() int {
+	return q.ll.Len()
+}
+
+func (q *queue) contains(key string) bool {
+	_, ok := q.cache[key]
+	return ok
+}
+
+func (q *queue) get(key string) (*entry, bool) {
+	if ele, ok := q.cache[key]; ok {
+		q.ll.MoveToFront(ele)
+		return ele.Value.(*entry), true
+	}
+	return nil, false
+}
+
+func (q *queue) push(kv *entry) {
+	q.cache[kv.key] = q.ll.PushFront(kv)
+	q.nbytes += int64(len(kv.key)) + int64(kv.value.Len())
+}
+
+func (q *queue) pop() *entry {
+	ele := q.ll.Back()
+	if ele == nil {
+		return nil
+	}
+	return q.removeElement(ele)
+}
+
+func (q *queue) remove(key string) (*entry, bool) {
+	if ele, ok := q.cache[key]; ok {
+		return q.removeElement(ele), true
+	}
+	return nil, false
+}
+
+func (q *queue) removeIf(fn func(key string, value Value) bool) []*entry {
+	var removed []*entry
+	for ele := q.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if kv := ele.Value.(*entry); fn(kv.key, kv.value) {
+			removed = append(removed, q.removeElement(ele))
+		}
+		ele = prev
+	}
+	return removed
+}
+
+func (q *queue) removeElement(ele *list.Element) *entry {
+	q.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(q.cache, kv.key)
+	q.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	return kv
+}
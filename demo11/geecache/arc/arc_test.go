@@ -0,0 +1,61 @@
+package arc
+
+import (
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	limit := int64(len("k1v1") * 4)
+	c := New(limit, nil)
+	c.Add("k1", String("vv"))
+	c.Add("k2", String("vv"))
+	c.Get("k1")
+	c.Get("k2")
+	for _, k := range []string{"k3", "k4", "k5"} {
+		c.Add(k, String("vv"))
+	}
+	if _, ok := c.Get("k3"); ok || !c.b1.contains("k3") {
+		t.Fatalf("k3 should be evicted into b1")
+	}
+
+	c.Add("k3", String("vv"))
+	if c.p == 0 || !c.t2.contains("k3") {
+		t.Fatalf("hit in b1 should grow p and move k3 to t2, p=%d", c.p)
+	}
+	if c.Bytes() > limit {
+		t.Fatalf("bytes %d exceed limit", c.Bytes())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	c := New(int64(0), func(string, Value) { evicted++ })
+	c.Add("key", String("1"))
+	c.Add("key", String("111"))
+	c.Add("k2", String("22"))
+	c.Remove("k2")
+
+	if c.Bytes() != int64(len("key")+len("111")) || evicted != 1 {
+		t.Fatal("expected 6 but got", c.Bytes())
+	}
+	if n := c.RemoveIf(func(string, Value) bool { return true }); n != 1 || c.Bytes() != 0 {
+		t.Fatalf("RemoveIf expected 1 removed, got %d", n)
+	}
+}
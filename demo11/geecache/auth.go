@@ -0,0 +1,111 @@
+package geecache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signatureHeader 的格式为 <unix 秒>:<hex(HMAC-SHA256)>
+	signatureHeader = "Geecache-Signature"
+	// signatureMaxSkew 是签名时间与本地时间允许的最大偏差，超出的请求视为重放
+	signatureMaxSkew = 5 * time.Minute
+)
+
+var errUnauthenticated = errors.New("unauthenticated")
+
+// WithTLS 使 peer 之间通过双向 TLS 通信：访问 peer 时使用 cfg 作为客户端配置，
+// ServeHTTP 拒绝没有经过验证的客户端证书的请求。
+// 监听需由调用方使用同一个 cfg 启动，cfg 通常由 NewMutualTLSConfig 创建
+func WithTLS(cfg *tls.Config) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.tlsConfig = cfg
+	}
+}
+
+// WithHMAC 要求 peer 之间的每个请求都携带用 secret 计算的 HMAC-SHA256 签名，
+// 签名覆盖请求方法、URI、时间戳和请求体
+func WithHMAC(secret []byte) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.secret = secret
+	}
+}
+
+// NewMutualTLSConfig 读取本节点的证书和 CA 证书，创建同时用于服务端和客户端的配置，
+// 对端证书必须由 caFile 中的 CA 签发
+func NewMutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// authenticate 校验请求的客户端证书和签名，需要读取请求体时会将其替换为读取后的副本
+func (p *HTTPPool) authenticate(r *http.Request) error {
+	if p.tlsConfig != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return fmt.Errorf("%w: client certificate required", errUnauthenticated)
+	}
+	if p.secret == nil {
+		return nil
+	}
+	ts, sig, ok := strings.Cut(r.Header.Get(signatureHeader), ":")
+	if !ok {
+		return fmt.Errorf("%w: missing signature", errUnauthenticated)
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad signature timestamp", errUnauthenticated)
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return fmt.Errorf("%w: signature expired", errUnauthenticated)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	want := signature(p.secret, r.Method, r.RequestURI, ts, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return fmt.Errorf("%w: bad signature", errUnauthenticated)
+	}
+	return nil
+}
+
+func signRequest(req *http.Request, secret, body []byte) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(signatureHeader, ts+":"+signature(secret, req.Method, req.URL.RequestURI(), ts, body))
+}
+
+func signature(secret []byte, method, uri, ts string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%x", method, uri, ts, bodySum)
+	return hex.EncodeToString(mac.Sum(nil))
+}
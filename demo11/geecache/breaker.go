@@ -0,0 +1,76 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 表示 peer 的熔断器处于打开状态，请求未发出即失败
+var ErrCircuitOpen = errors.New("geecache: circuit breaker is open")
+
+// CircuitBreaker 配置访问单个 peer 的熔断：连续失败 Failures 次后熔断 Cooldown，
+// 期间的请求立即失败；冷却结束后只放行一个探测请求，成功则恢复。Failures 为 0 表示不熔断
+type CircuitBreaker struct {
+	Failures int
+	Cooldown time.Duration
+}
+
+var defaultCircuitBreaker = CircuitBreaker{Failures: 5, Cooldown: 10 * time.Second}
+
+type breaker struct {
+	cfg       CircuitBreaker
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // 冷却结束后已有一个探测请求在进行
+}
+
+func newBreaker(cfg CircuitBreaker) *breaker {
+	if cfg.Failures <= 0 {
+		return nil
+	}
+	return &breaker{cfg: cfg}
+}
+
+// allow 判断是否可以发出请求，返回 nil 时调用方必须随后以同一个 probe 调用 done，
+// probe 表示该请求是冷却结束后的探测请求
+func (b *breaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.cfg.Failures {
+		return false, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done 记录请求结果，counted 为 false 时（例如调用方主动取消）不计入成功或失败，
+// 只有探测请求结束时才允许下一个探测
+func (b *breaker) done(probe, ok, counted bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !counted {
+		return
+	}
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.cfg.Failures {
+		b.openUntil = time.Now().Add(b.cfg.Cooldown)
+	}
+}
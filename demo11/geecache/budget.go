@@ -0,0 +1,250 @@
+package geecache
+
+import (
+	"log"
+	"math"
+	"runtime/debug"
+	rtmetrics "runtime/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	// budgetReserveFraction 表示预算中平均分给各个 Group 的比例为 1/budgetReserveFraction，
+	// 其余部分按最近的命中数分配
+	budgetReserveFraction = 4
+	// budgetDecay 是每次重新分配时历史命中数保留的权重
+	budgetDecay = 0.5
+	// 堆内存超过上限的 budgetHighWater 时收缩预算，低于 budgetLowWater 时逐步恢复
+	budgetHighWater    = 0.9
+	budgetLowWater     = 0.7
+	budgetShrinkFactor = 0.75
+	budgetMinScale     = 0.1
+)
+
+// Budget 是多个 Group 共享的进程级字节预算，
+// 定期按各 Group 最近的命中数重新分配，并在堆内存接近上限时整体收缩。
+// 堆内存上限来自 WithHeapLimit 或 debug.SetMemoryLimit，两者都未设置时不会因内存压力收缩。
+// 加入 Budget 的 Group 的字节上限由 Budget 管理，对它调用 SetCacheBytes 只修改它能分到的最大值
+type Budget struct {
+	maxBytes  int64
+	heapLimit uint64
+	readHeap  func() uint64
+	mu        sync.Mutex
+	scale     float64 // 受内存压力影响的预算比例，取值 [budgetMinScale, 1]
+	entries   map[*Group]*budgetEntry
+}
+
+type budgetEntry struct {
+	maxBytes int64 // 创建 Group 时传入的 cacheBytes，0 表示不限制
+	lastHits int64
+	score    float64
+}
+
+// BudgetStats 是 Budget 的状态快照
+type BudgetStats struct {
+	MaxBytes  int64  `json:"maxBytes"`
+	Bytes     int64  `json:"bytes"` // 收缩后实际分配的预算
+	Groups    int    `json:"groups"`
+	HeapLive  uint64 `json:"heapLive"`
+	HeapLimit uint64 `json:"heapLimit"` // 0 表示未设置内存上限
+}
+
+type BudgetOption func(*Budget)
+
+// WithHeapLimit 设置判断内存压力使用的堆内存上限，默认使用 debug.SetMemoryLimit 设置的值
+func WithHeapLimit(limit uint64) BudgetOption {
+	return func(b *Budget) {
+		b.heapLimit = limit
+	}
+}
+
+func NewBudget(maxBytes int64, opts ...BudgetOption) *Budget {
+	if maxBytes <= 0 {
+		panic("geecache: budget must be positive")
+	}
+	b := &Budget{
+		maxBytes: maxBytes,
+		readHeap: readHeapLive,
+		scale:    1,
+		entries:  make(map[*Group]*budgetEntry),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithBudget 使 Group 从 b 中分配字节上限，cacheBytes 作为它能分到的最大值
+func WithBudget(b *Budget) GroupOption {
+	return func(g *Group) {
+		g.budget = b
+	}
+}
+
+// Start 每隔 interval 检查一次堆内存并重新分配预算，返回的函数用于停止
+func (b *Budget) Start(interval time.Duration) (stop func()) {
+	if b.limit() == 0 {
+		log.Println("[GeeCache] no heap limit set, the cache budget will not shrink under memory pressure; use WithHeapLimit or debug.SetMemoryLimit")
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.Rebalance()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Rebalance 根据当前的堆内存和各 Group 最近的命中数立即重新分配预算
+func (b *Budget) Rebalance() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.adjustForHeap()
+	for g, e := range b.entries {
+		hits := g.stats.cacheHits.Load()
+		e.score = e.score*budgetDecay + float64(hits-e.lastHits)
+		e.lastHits = hits
+	}
+	b.allocate()
+}
+
+func (b *Budget) Stats() BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BudgetStats{
+		MaxBytes:  b.maxBytes,
+		Bytes:     b.effectiveBytes(),
+		Groups:    len(b.entries),
+		HeapLive:  b.readHeap(),
+		HeapLimit: b.limit(),
+	}
+}
+
+func (b *Budget) add(g *Group, maxBytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[g] = &budgetEntry{maxBytes: maxBytes, lastHits: g.stats.cacheHits.Load()}
+	b.allocate()
+}
+
+// setMax 修改 g 能分到的最大值并重新分配，g 不在 Budget 中时返回 false
+func (b *Budget) setMax(g *Group, maxBytes int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[g]
+	if !ok {
+		return false
+	}
+	e.maxBytes = maxBytes
+	b.allocate()
+	return true
+}
+
+func (b *Budget) remove(g *Group) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.entries[g]; ok {
+		delete(b.entries, g)
+		b.allocate()
+	}
+}
+
+func (b *Budget) limit() uint64 {
+	if b.heapLimit > 0 {
+		return b.heapLimit
+	}
+	if l := debug.SetMemoryLimit(-1); l != math.MaxInt64 {
+		return uint64(l)
+	}
+	return 0
+}
+
+func (b *Budget) effectiveBytes() int64 {
+	return int64(float64(b.maxBytes) * b.scale)
+}
+
+// adjustForHeap 在堆内存接近上限时收缩预算，压力解除后逐步恢复
+func (b *Budget) adjustForHeap() {
+	limit := b.limit()
+	if limit == 0 {
+		b.scale = 1
+		return
+	}
+	live := float64(b.readHeap())
+	switch {
+	case live >= float64(limit)*budgetHighWater:
+		b.scale = max(b.scale*budgetShrinkFactor, budgetMinScale)
+		log.Printf("[GeeCache] heap %d bytes is close to the limit %d, shrinking cache budget to %d bytes",
+			uint64(live), limit, b.effectiveBytes())
+	case live <= float64(limit)*budgetLowWater:
+		b.scale = min(b.scale/budgetShrinkFactor, 1)
+	}
+}
+
+// allocate 先平均分配预算的 1/budgetReserveFraction，其余按 score 分配，
+// 分到的字节超过 Group 自身上限的部分留给其他 Group
+func (b *Budget) allocate() {
+	left := b.effectiveBytes()
+	shares := make(map[*Group]int64, len(b.entries))
+	active := make([]*Group, 0, len(b.entries))
+	for g := range b.entries {
+		active = append(active, g)
+	}
+	for len(active) > 0 {
+		n := int64(len(active))
+		reserve := left / budgetReserveFraction / n
+		rest := left - reserve*n
+		var sum float64
+		for _, g := range active {
+			sum += b.entries[g].score
+		}
+		next := active[:0]
+		capped := false
+		for _, g := range active {
+			share := reserve + rest/n
+			if sum > 0 {
+				share = reserve + int64(float64(rest)*b.entries[g].score/sum)
+			}
+			shares[g] = share
+			if e := b.entries[g]; e.maxBytes > 0 && share >= e.maxBytes {
+				shares[g] = e.maxBytes
+				left -= e.maxBytes
+				capped = true
+				continue
+			}
+			next = append(next, g)
+		}
+		if !capped {
+			break
+		}
+		active = next
+	}
+	// 先收缩再扩大，保证任何时刻的总和都不超过预算
+	for _, grow := range []bool{false, true} {
+		for g, share := range shares {
+			share = max(share, 1) // 0 表示不限制
+			if (share > g.CacheBytes()) == grow {
+				g.resize(share)
+			}
+		}
+	}
+}
+
+// readHeapLive 返回上一次 GC 后存活的堆内存字节数
+func readHeapLive() uint64 {
+	s := []rtmetrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	rtmetrics.Read(s)
+	if s[0].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return s[0].Value.Uint64()
+}
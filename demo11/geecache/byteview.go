@@ -1,7 +1,14 @@
 package geecache
 
+import (
+	"time"
+)
+
 type BytesView struct {
-	b []byte
+	b   []byte
+	e   time.Time
+	enc Encoding
+	ttl time.Duration // Getter 为该条目指定的 TTL，0 表示使用 Group 的默认 TTL
 }
 
 func cloneBytes(b []byte) []byte {
@@ -10,14 +17,42 @@ func cloneBytes(b []byte) []byte {
 	return c
 }
 
+// Len 返回 value 占用的字节数，压缩保存时为压缩后的大小
 func (v BytesView) Len() int {
 	return len(v.b)
 }
 
+// ByteSlice 返回数据的副本，解压失败时返回 nil，需要区分错误时使用 Bytes
 func (v BytesView) ByteSlice() []byte {
-	return cloneBytes(v.b)
+	b, _ := v.Bytes()
+	return b
+}
+
+// Bytes 返回数据的副本，压缩保存的 value 解压失败时返回错误
+func (v BytesView) Bytes() ([]byte, error) {
+	if v.enc != Identity {
+		return v.bytes()
+	}
+	return cloneBytes(v.b), nil
 }
 
 func (v BytesView) String() string {
-	return string(v.b)
+	b, _ := v.bytes()
+	return string(b)
+}
+
+// Expire 返回过期时间，零值表示永不过期
+func (v BytesView) Expire() time.Time {
+	return v.e
+}
+
+func (v BytesView) expired(now time.Time) bool {
+	return !v.e.IsZero() && now.After(v.e)
+}
+
+// bytes 返回解压后的数据，未压缩时不复制。
+// 只有本节点压缩的 value 会以压缩形式进入缓存，peer 返回的 value 在 peerValue 中已经解压，
+// 因此这里不限制解压后的大小
+func (v BytesView) bytes() ([]byte, error) {
+	return decodeValue(v.b, v.enc, 0)
 }
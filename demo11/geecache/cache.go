@@ -1,34 +1,364 @@
 package geecache
 
 import (
+	"hash/maphash"
+	"log"
+	"math/bits"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/zsm/demo11/geecache/disk"
 	"github.com/zsm/demo11/geecache/lru"
 )
 
+const defaultCleanupInterval = time.Minute
+
+// minShardBytes 是默认分片时每个 shard 至少分到的字节数，容量较小的缓存会减少 shard 数量，
+// 避免单个 shard 小到放不下一个条目
+const minShardBytes = 64 << 10
+
+// defaultShards 返回不小于 GOMAXPROCS 的最小 2 的幂，并按 minShardBytes 减少
+func defaultShards(cacheBytes int64) int {
+	n := 1 << bits.Len(uint(runtime.GOMAXPROCS(0)-1))
+	for n > 1 && cacheBytes > 0 && cacheBytes/int64(n) < minShardBytes {
+		n /= 2
+	}
+	return n
+}
+
+// cache 按 key 的哈希值分为若干个 shard，每个 shard 有独立的锁和字节上限，
+// 避免并发读写时所有请求竞争同一把锁
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64
+	policy Policy
+	// cacheBytes 是创建时的字节上限，运行时的上限保存在 maxBytes 中
+	cacheBytes      int64
+	maxBytes        atomic.Int64
+	nshards         int // 为 0 时使用 defaultShards
+	cleanupInterval time.Duration
+	// staleWindow 内已过期的条目仍会被 get 返回，由调用方决定是否刷新
+	staleWindow time.Duration
+	initOnce    sync.Once
+	shards      []*shard
+	seed        maphash.Seed
+	janitorOnce sync.Once
+	closeOnce   sync.Once
+	done        chan struct{}
+	// disk 不为 nil 时，被淘汰的条目会写入磁盘，未命中内存时再从磁盘读回
+	disk *disk.Store
+}
+
+// shard 的计数器同样由 mu 保护，避免多个 shard 竞争同一个原子变量
+type shard struct {
+	mu                 sync.Mutex
+	ev                 EvictionPolicy
+	nget, nhit, nevict int64
+	ndisk              int64
+	// removing 为 true 时表示正在主动删除条目，此时的回调不计入淘汰，也不写入磁盘
+	removing bool
+	// pending 是持有 mu 时排队的磁盘写入和删除，释放 mu 后由 flush 按顺序执行，
+	// 避免磁盘 I/O 阻塞同一个 shard 上的内存命中
+	pending []diskOp
+	// gen 在每次修改 shard 时加一，用于发现读取磁盘期间 key 是否被修改过
+	gen uint64
+	// diskMu 保证 pending 按排队的顺序写入磁盘，读取磁盘时也需持有
+	diskMu sync.Mutex
+}
+
+type diskOp struct {
+	key    string
+	value  BytesView
+	delete bool
+}
+
+// CacheStats 是单个缓存的统计信息
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"maxBytes"` // 0 表示不限制
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	DiskHits  int64 `json:"diskHits"`
+	DiskBytes int64 `json:"diskBytes"`
+}
+
+func (c *cache) init() {
+	c.initOnce.Do(func() {
+		policy := c.policy
+		if policy == nil {
+			policy = LRU
+		}
+		n := c.nshards
+		if n <= 0 {
+			n = defaultShards(c.cacheBytes)
+		}
+		shardBytes := c.cacheBytes / int64(n)
+		if c.cacheBytes > 0 {
+			shardBytes = max(shardBytes, 1)
+		}
+		c.maxBytes.Store(c.cacheBytes)
+		c.done = make(chan struct{})
+		c.seed = maphash.MakeSeed()
+		c.shards = make([]*shard, n)
+		for i := range c.shards {
+			sh := &shard{}
+			sh.ev = policy(shardBytes, func(key string, value lru.Value) {
+				if sh.removing {
+					return
+				}
+				sh.nevict++
+				if c.disk != nil {
+					sh.pending = append(sh.pending, diskOp{key: key, value: value.(BytesView)})
+				}
+			})
+			c.shards[i] = sh
+		}
+	})
+}
+
+func (c *cache) shardFor(key string) *shard {
+	c.init()
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+func (c *cache) stats() CacheStats {
+	c.init()
+	s := CacheStats{MaxBytes: c.maxBytes.Load()}
+	for _, sh := range c.shards {
+		sh.mu.Lock()
+		s.Gets += sh.nget
+		s.Hits += sh.nhit
+		s.Evictions += sh.nevict
+		s.DiskHits += sh.ndisk
+		s.Bytes += sh.ev.Bytes()
+		s.Items += int64(sh.ev.Len())
+		sh.mu.Unlock()
+	}
+	s.Misses = s.Gets - s.Hits
+	if c.disk != nil {
+		s.DiskBytes = c.disk.Bytes()
+	}
+	return s
 }
 
 func (c *cache) add(key string, value BytesView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	sh := c.shardFor(key)
+	sh.mu.Lock()
+	c.queueDelete(sh, key)
+	sh.ev.Add(key, value)
+	sh.gen++
+	sh.mu.Unlock()
+	c.flush(sh)
+	if !value.e.IsZero() {
+		c.janitorOnce.Do(func() { go c.janitor() })
 	}
-	c.lru.Add(key, value)
 }
 
 func (c *cache) get(key string) (value BytesView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	sh := c.shardFor(key)
+	sh.mu.Lock()
+	sh.nget++
+	if v, ok := sh.ev.Get(key); ok {
+		if v.(BytesView).expired(time.Now().Add(-c.staleWindow)) {
+			sh.removeLocked(key)
+			sh.gen++
+			sh.mu.Unlock()
+			return BytesView{}, false
+		}
+		sh.nhit++
+		sh.mu.Unlock()
+		return v.(BytesView), ok
+	}
+	gen := sh.gen
+	sh.mu.Unlock()
+	if c.disk == nil {
+		return BytesView{}, false
+	}
+	return c.getFromDisk(sh, key, gen)
+}
+
+func (c *cache) remove(key string) {
+	sh := c.shardFor(key)
+	sh.mu.Lock()
+	sh.removeLocked(key)
+	c.queueDelete(sh, key)
+	sh.gen++
+	sh.mu.Unlock()
+	c.flush(sh)
+}
+
+func (sh *shard) removeLocked(key string) {
+	sh.removing = true
+	sh.ev.Remove(key)
+	sh.removing = false
+}
+
+// spill 将被淘汰的条目写入磁盘，已过期的条目直接丢弃
+func (c *cache) spill(key string, value BytesView) {
+	if c.disk == nil || value.expired(time.Now()) {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(BytesView), ok
+	var expire int64
+	if !value.e.IsZero() {
+		expire = value.e.UnixNano()
+	}
+	b, err := value.bytes()
+	if err == nil {
+		err = c.disk.Put(key, b, expire)
+	}
+	if err != nil {
+		log.Printf("[GeeCache] spill %s to disk: %v", key, err)
+	}
+}
+
+// getFromDisk 在不持有 sh.mu 的情况下从磁盘读取条目，读回后放回内存并从磁盘删除，
+// 保证同一个 key 不会同时存在于内存和磁盘中。gen 是读取前 shard 的版本，
+// 读取期间 shard 被修改过时丢弃读到的数据，避免读回已被删除或覆盖的旧值
+func (c *cache) getFromDisk(sh *shard, key string, gen uint64) (BytesView, bool) {
+	sh.diskMu.Lock()
+	c.flushLocked(sh)
+	b, expire, ok, err := c.disk.Get(key)
+	sh.diskMu.Unlock()
+	if err != nil {
+		log.Printf("[GeeCache] read %s from disk: %v", key, err)
+		return BytesView{}, false
+	}
+	if !ok {
+		return BytesView{}, false
+	}
+	value := BytesView{b: b}
+	if expire != 0 {
+		value.e = time.Unix(0, expire)
+	}
+	expired := value.expired(time.Now())
+
+	sh.mu.Lock()
+	if sh.gen != gen {
+		sh.mu.Unlock()
+		return BytesView{}, false
+	}
+	c.queueDelete(sh, key)
+	if !expired {
+		sh.nhit++
+		sh.ndisk++
+		sh.ev.Add(key, value)
+	}
+	sh.gen++
+	sh.mu.Unlock()
+	c.flush(sh)
+	return value, !expired
+}
+
+// queueDelete 排队删除磁盘上的 key，调用方需持有 sh.mu，并在释放后调用 flush
+func (c *cache) queueDelete(sh *shard, key string) {
+	if c.disk != nil {
+		sh.pending = append(sh.pending, diskOp{key: key, delete: true})
+	}
+}
+
+// flush 按排队的顺序执行 shard 上的磁盘操作，调用方不能持有 sh.mu
+func (c *cache) flush(sh *shard) {
+	if c.disk == nil {
+		return
+	}
+	sh.diskMu.Lock()
+	defer sh.diskMu.Unlock()
+	c.flushLocked(sh)
+}
+
+// flushLocked 与 flush 相同，调用方需持有 sh.diskMu。只有持有 diskMu 时才取出 pending，
+// 因此操作总是按排队的顺序执行
+func (c *cache) flushLocked(sh *shard) {
+	for {
+		sh.mu.Lock()
+		ops := sh.pending
+		sh.pending = nil
+		sh.mu.Unlock()
+		if len(ops) == 0 {
+			return
+		}
+		for _, op := range ops {
+			if op.delete {
+				c.deleteFromDisk(op.key)
+			} else {
+				c.spill(op.key, op.value)
+			}
+		}
+	}
+}
+
+func (c *cache) deleteFromDisk(key string) {
+	if err := c.disk.Delete(key); err != nil {
+		log.Printf("[GeeCache] delete %s from disk: %v", key, err)
+	}
+}
+
+// removeExpired 清理已过期的条目，释放其占用的字节
+func (c *cache) removeExpired() int {
+	c.init()
+	now := time.Now().Add(-c.staleWindow)
+	n := 0
+	for _, sh := range c.shards {
+		sh.mu.Lock()
+		sh.removing = true
+		n += sh.ev.RemoveIf(func(key string, value lru.Value) bool {
+			return value.(BytesView).expired(now)
+		})
+		sh.removing = false
+		sh.gen++
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// janitor 在后台定期清理过期条目，只有出现带过期时间的条目时才会启动
+func (c *cache) janitor() {
+	interval := c.cleanupInterval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close 停止后台清理，已缓存的条目仍可读取
+func (c *cache) close() {
+	c.init()
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// capacity 返回当前的字节上限，0 表示不限制
+func (c *cache) capacity() int64 {
+	c.init()
+	return c.maxBytes.Load()
+}
+
+// resize 修改字节上限并平均分给各个 shard，缩小时超出的条目按淘汰处理
+func (c *cache) resize(cacheBytes int64) {
+	c.init()
+	c.maxBytes.Store(cacheBytes)
+	shardBytes := cacheBytes / int64(len(c.shards))
+	if cacheBytes > 0 {
+		shardBytes = max(shardBytes, 1)
+	}
+	for _, sh := range c.shards {
+		sh.mu.Lock()
+		sh.ev.SetMaxBytes(shardBytes)
+		sh.mu.Unlock()
+		c.flush(sh)
 	}
-	return
 }
@@ -0,0 +1,147 @@
+package geecache
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zsm/demo11/geecache/disk"
+)
+
+func TestShardedCache(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, nshards: 8}
+	for i := 0; i < 100; i++ {
+		c.add(strconv.Itoa(i), BytesView{b: []byte("v")})
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := c.get(strconv.Itoa(i)); !ok || v.String() != "v" {
+			t.Fatalf("cache miss %d", i)
+		}
+	}
+	if s := c.stats(); s.Items != 100 || s.Hits != 100 || len(c.shards) != 8 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestShardedCacheBytes(t *testing.T) {
+	c := &cache{cacheBytes: 64, nshards: 4}
+	for i := 0; i < 100; i++ {
+		c.add(fmt.Sprintf("%03d", i), BytesView{b: []byte("v")})
+	}
+	if s := c.stats(); s.Bytes > 64 || s.Evictions == 0 {
+		t.Fatalf("sharded cache should respect byte budget, got %+v", s)
+	}
+}
+
+// BenchmarkCacheGet 比较不同 shard 数量下的并发读吞吐，
+func TestDefaultShards(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(6))
+	if n := defaultShards(0); n != 8 {
+		t.Fatalf("unlimited cache got %d shards, want 8", n)
+	}
+	if n := defaultShards(1 << 30); n != 8 {
+		t.Fatalf("large cache got %d shards, want 8", n)
+	}
+	if n := defaultShards(2 * minShardBytes); n != 2 {
+		t.Fatalf("small cache got %d shards, want 2", n)
+	}
+	if n := defaultShards(16); n != 1 {
+		t.Fatalf("tiny cache got %d shards, want 1", n)
+	}
+	c := &cache{cacheBytes: 1 << 30}
+	c.init()
+	if len(c.shards) != 8 {
+		t.Fatalf("cache got %d shards by default, want 8", len(c.shards))
+	}
+}
+
+// 可通过 go test -bench CacheGet -cpu 1,2,4,8 观察随 GOMAXPROCS 的扩展
+func BenchmarkCacheGet(b *testing.B) {
+	const keys = 1024
+	for _, n := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			c := &cache{nshards: n}
+			names := make([]string, keys)
+			for i := range names {
+				names[i] = strconv.Itoa(i)
+				c.add(names[i], BytesView{b: []byte("value")})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(names[i%keys])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	store, err := disk.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &cache{cacheBytes: 16, disk: store}
+	for i := 0; i < 10; i++ {
+		c.add(fmt.Sprintf("k%d", i), BytesView{b: []byte("v")})
+	}
+	if v, ok := c.get("k0"); !ok || v.String() != "v" {
+		t.Fatalf("evicted k0 should be read back from disk")
+	}
+	if s := c.stats(); s.DiskHits != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	c.remove("k1")
+	if _, ok := c.get("k1"); ok {
+		t.Fatalf("removed k1 should not be read back from disk")
+	}
+	store.Close()
+
+	store, err = disk.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	c = &cache{cacheBytes: 16, disk: store}
+	if v, ok := c.get("k2"); !ok || v.String() != "v" {
+		t.Fatalf("k2 should survive restart")
+	}
+}
+
+func TestDiskTierOutsideLock(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	c := &cache{cacheBytes: 1 << 10, disk: store}
+	c.add("hot", BytesView{b: []byte("v")})
+	sh := c.shardFor("hot")
+
+	// 持有 diskMu 模拟一次很慢的磁盘读写，内存命中不应被阻塞
+	sh.diskMu.Lock()
+	missed := make(chan struct{})
+	go func() {
+		c.get("cold")
+		close(missed)
+	}()
+	hit := make(chan struct{})
+	go func() {
+		if v, ok := c.get("hot"); !ok || v.String() != "v" {
+			t.Errorf("memory hit failed")
+		}
+		close(hit)
+	}()
+	select {
+	case <-hit:
+	case <-time.After(time.Second):
+		t.Fatalf("memory hit blocked by disk")
+	}
+	sh.diskMu.Unlock()
+	<-missed
+}
@@ -0,0 +1,71 @@
+package geecache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 负责 TypedGroup 中 T 与缓存字节之间的转换
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(b []byte) (T, error)
+}
+
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+type MsgpackCodec[T any] struct{}
+
+func (MsgpackCodec[T]) Marshal(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(b, &v)
+	return v, err
+}
+
+// ProtoCodec 的 T 为生成的消息指针类型，例如 *pb.Response
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Unmarshal(b []byte) (T, error) {
+	// 生成代码的 ProtoReflect 允许 nil 接收者，借此创建一个新的 T
+	var zero T
+	v := zero.ProtoReflect().Type().New().Interface().(T)
+	err := proto.Unmarshal(b, v)
+	return v, err
+}
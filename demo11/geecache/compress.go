@@ -0,0 +1,215 @@
+package geecache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+)
+
+// Encoding 是 value 在缓存中保存和在节点间传输时的压缩方式
+type Encoding int32
+
+const (
+	Identity = Encoding(pb.Encoding_IDENTITY)
+	Gzip     = Encoding(pb.Encoding_GZIP)
+	Zstd     = Encoding(pb.Encoding_ZSTD)
+	Snappy   = Encoding(pb.Encoding_SNAPPY)
+)
+
+// acceptEncodingHeader 用于 HTTP GET 请求携带 pb.Request.accept_encoding，
+// 不使用 Accept-Encoding 以免与 net/http 自动的 gzip 协商冲突
+const acceptEncodingHeader = "Geecache-Accept-Encoding"
+
+var errValueTooLarge = errors.New("decoded value is too large")
+
+type codec struct {
+	encode func([]byte) ([]byte, error)
+	// decode 解压 b，limit 大于 0 时解压后超过 limit 字节即失败
+	decode func(b []byte, limit int64) ([]byte, error)
+}
+
+var (
+	// zstd 的 Encoder 和 Decoder 在只使用 EncodeAll/DecodeAll 时可以并发使用
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+	// zstdStreams 用于需要限制大小的流式解压，流式解压的 Decoder 不能并发使用
+	zstdStreams = sync.Pool{New: func() any {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		return d
+	}}
+
+	codecs = map[Encoding]codec{
+		Gzip: {
+			encode: func(b []byte) ([]byte, error) {
+				var buf bytes.Buffer
+				w := gzip.NewWriter(&buf)
+				if _, err := w.Write(b); err != nil {
+					return nil, err
+				}
+				if err := w.Close(); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
+			},
+			decode: func(b []byte, limit int64) ([]byte, error) {
+				r, err := gzip.NewReader(bytes.NewReader(b))
+				if err != nil {
+					return nil, err
+				}
+				return readLimited(r, limit)
+			},
+		},
+		Zstd: {
+			encode: func(b []byte) ([]byte, error) {
+				return zstdEncoder.EncodeAll(b, nil), nil
+			},
+			decode: func(b []byte, limit int64) ([]byte, error) {
+				if limit <= 0 {
+					return zstdDecoder.DecodeAll(b, nil)
+				}
+				var h zstd.Header
+				if err := h.Decode(b); err != nil {
+					return nil, err
+				}
+				if h.HasFCS && h.FrameContentSize > uint64(limit) {
+					return nil, errValueTooLarge
+				}
+				// 帧头不一定声明解压后的大小，只能边解压边限制
+				d := zstdStreams.Get().(*zstd.Decoder)
+				defer zstdStreams.Put(d)
+				if err := d.Reset(bytes.NewReader(b)); err != nil {
+					return nil, err
+				}
+				return readLimited(d, limit)
+			},
+		},
+		Snappy: {
+			encode: func(b []byte) ([]byte, error) {
+				return snappy.Encode(nil, b), nil
+			},
+			decode: func(b []byte, limit int64) ([]byte, error) {
+				n, err := snappy.DecodedLen(b)
+				if err != nil {
+					return nil, err
+				}
+				if limit > 0 && int64(n) > limit {
+					return nil, errValueTooLarge
+				}
+				return snappy.Decode(nil, b)
+			},
+		},
+	}
+
+	// acceptEncodings 是本节点能够解压的编码，随每个请求发送给 peer
+	acceptEncodings = []pb.Encoding{pb.Encoding_ZSTD, pb.Encoding_SNAPPY, pb.Encoding_GZIP}
+)
+
+// WithCompression 使 mainCache 以 enc 压缩保存不小于 minSize 字节的 value，
+// 只有压缩后至少节省 1/8 空间时才会压缩，BytesView.Len 返回压缩后的大小
+func WithCompression(enc Encoding, minSize int) GroupOption {
+	return func(g *Group) {
+		g.compression = enc
+		g.compressMinSize = minSize
+	}
+}
+
+// decodeValue 解压 b，limit 为 0 表示不限制解压后的大小，只应用于本节点压缩的数据
+func decodeValue(b []byte, enc Encoding, limit int64) ([]byte, error) {
+	if enc == Identity {
+		return b, nil
+	}
+	c, ok := codecs[enc]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %d", enc)
+	}
+	return c.decode(b, limit)
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(out)) > limit {
+		err = errValueTooLarge
+	}
+	return out, err
+}
+
+// compress 按 Group 的配置压缩 value，压缩失败或收益不足时原样返回
+func (g *Group) compress(value BytesView) BytesView {
+	c, ok := codecs[g.compression]
+	if !ok || value.enc != Identity || len(value.b) < g.compressMinSize {
+		return value
+	}
+	b, err := c.encode(value.b)
+	if err != nil || len(b) > len(value.b)-len(value.b)/8 {
+		return value
+	}
+	value.b, value.enc = b, g.compression
+	return value
+}
+
+// wireValue 返回发送给 peer 的 value，保存的编码不在 accept 中时先解压
+func wireValue(view BytesView, accept []pb.Encoding) ([]byte, pb.Encoding, error) {
+	if view.enc == Identity {
+		return view.b, pb.Encoding_IDENTITY, nil
+	}
+	for _, enc := range accept {
+		if Encoding(enc) == view.enc {
+			return view.b, enc, nil
+		}
+	}
+	b, err := view.bytes()
+	return b, pb.Encoding_IDENTITY, err
+}
+
+// valueLimiter 由限制了响应大小的 PeerGetter 实现，解压 peer 返回的 value 时使用同样的上限
+type valueLimiter interface {
+	maxValueSize() int64
+}
+
+// valueLimit 返回解压 peer 返回的 value 时的上限，未设置时使用 defaultMaxBodySize
+func valueLimit(peer PeerGetter) int64 {
+	if l, ok := peer.(valueLimiter); ok && l.maxValueSize() > 0 {
+		return l.maxValueSize()
+	}
+	return defaultMaxBodySize
+}
+
+// peerValue 将 peer 返回的 value 解压为 BytesView，解压后超过 limit 字节或数据损坏时返回错误，
+// 由调用方改为在本地加载
+func peerValue(b []byte, enc pb.Encoding, e time.Time, limit int64) (BytesView, error) {
+	b, err := decodeValue(b, Encoding(enc), limit)
+	if err != nil {
+		return BytesView{}, fmt.Errorf("decoding %v value: %w", enc, err)
+	}
+	return BytesView{b: b, e: e}, nil
+}
+
+func formatEncodings(encs []pb.Encoding) string {
+	names := make([]string, len(encs))
+	for i, enc := range encs {
+		names[i] = strings.ToLower(enc.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func parseEncodings(s string) []pb.Encoding {
+	var encs []pb.Encoding
+	for _, name := range strings.Split(s, ",") {
+		if v, ok := pb.Encoding_value[strings.ToUpper(strings.TrimSpace(name))]; ok {
+			encs = append(encs, pb.Encoding(v))
+		}
+	}
+	return encs
+}
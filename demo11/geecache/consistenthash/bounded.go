@@ -0,0 +1,105 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Bounded 实现有界负载的一致性哈希 (https://arxiv.org/abs/1608.01350)：
+// 在哈希环上顺时针查找时跳过负载已达上限 ceil(平均负载*loadFactor) 的节点。
+// Get 会将所选节点的负载加一，请求结束后需调用 Done 释放
+type Bounded struct {
+	mu         sync.Mutex
+	ring       *Map
+	loads      map[string]int64
+	total      int64
+	loadFactor float64
+}
+
+func NewBounded(replicas int, fn Hash, loadFactor float64) *Bounded {
+	if loadFactor < 1 {
+		loadFactor = 1
+	}
+	return &Bounded{
+		ring:       New(replicas, fn),
+		loads:      make(map[string]int64),
+		loadFactor: loadFactor,
+	}
+}
+
+func (b *Bounded) Add(nodes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ring.Add(nodes...)
+	for _, node := range nodes {
+		if _, ok := b.loads[node]; !ok {
+			b.loads[node] = 0
+		}
+	}
+}
+
+func (b *Bounded) Remove(nodes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ring.Remove(nodes...)
+	for _, node := range nodes {
+		b.total -= b.loads[node]
+		delete(b.loads, node)
+	}
+}
+
+func (b *Bounded) Get(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.ring
+	if len(m.keys) == 0 {
+		return ""
+	}
+	maxLoad := b.maxLoad()
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	// maxLoad 不小于平均负载，因此总能找到未达上限的节点
+	node := m.hashMap[m.keys[idx%len(m.keys)]]
+	for i := 0; i < len(m.keys); i++ {
+		if n := m.hashMap[m.keys[(idx+i)%len(m.keys)]]; b.loads[n]+1 <= maxLoad {
+			node = n
+			break
+		}
+	}
+	b.loads[node]++
+	b.total++
+	return node
+}
+
+// Owner 返回 key 在哈希环上的所有者，不考虑负载也不增加负载，
+// 用于需要所有节点得到相同结果的场景，例如写操作的路由
+func (b *Bounded) Owner(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ring.Get(key)
+}
+
+// Done 释放 Get 为 node 增加的负载
+func (b *Bounded) Done(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if load, ok := b.loads[node]; ok && load > 0 {
+		b.loads[node]--
+		b.total--
+	}
+}
+
+// Load 返回 node 当前的负载
+func (b *Bounded) Load(node string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[node]
+}
+
+func (b *Bounded) maxLoad() int64 {
+	avg := float64(b.total+1) / float64(len(b.loads))
+	return int64(math.Ceil(avg * b.loadFactor))
+}
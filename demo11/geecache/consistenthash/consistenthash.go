@@ -13,6 +13,7 @@ type Map struct {
 	replicas int
 	keys     []int
 	hashMap  map[int]string
+	weights  map[string]int //真实节点 -> 权重，虚拟节点数为 replicas*weight
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -20,6 +21,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -29,15 +31,62 @@ func New(replicas int, fn Hash) *Map {
 
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
-		}
+		m.addNode(key, 1)
+	}
+	sort.Ints(m.keys)
+}
+
+// AddWeighted 添加一个权重为 weight 的节点，其虚拟节点数为 replicas*weight
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight <= 0 {
+		return
 	}
+	m.addNode(key, weight)
 	sort.Ints(m.keys)
 }
 
+func (m *Map) addNode(key string, weight int) {
+	if _, ok := m.weights[key]; ok {
+		m.removeNode(key)
+	}
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+}
+
+// Remove 删除节点及其所有虚拟节点
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		m.removeNode(key)
+	}
+}
+
+func (m *Map) removeNode(key string) {
+	weight, ok := m.weights[key]
+	if !ok {
+		return
+	}
+	delete(m.weights, key)
+	removed := make(map[int]bool, m.replicas*weight)
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		if m.hashMap[hash] == key {
+			delete(m.hashMap, hash)
+			removed[hash] = true
+		}
+	}
+	keys := m.keys[:0]
+	for _, hash := range m.keys {
+		if !removed[hash] {
+			keys = append(keys, hash)
+		}
+	}
+	m.keys = keys
+}
+
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
@@ -48,3 +97,25 @@ func (m *Map) Get(key string) string {
 	})
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN 沿哈希环顺时针返回 key 之后最多 n 个不同的真实节点，第一个即 Get 的结果
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(m.weights))
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -35,3 +35,89 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("A", "B", "C")
+
+	keys := make([]string, 1000)
+	before := make(map[string]string, len(keys))
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		before[keys[i]] = hash.Get(keys[i])
+	}
+
+	// 新节点加入时，只有分配给新节点的 key 会移动
+	hash.Add("D")
+	moved := 0
+	for _, k := range keys {
+		if owner := hash.Get(k); owner != before[k] {
+			if owner != "D" {
+				t.Fatalf("key %s moved from %s to %s instead of D", k, before[k], owner)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > len(keys)/2 {
+		t.Fatalf("unexpected number of moved keys: %d", moved)
+	}
+
+	// 节点离开后，所有 key 回到原来的节点
+	hash.Remove("D")
+	for _, k := range keys {
+		if owner := hash.Get(k); owner != before[k] {
+			t.Fatalf("key %s should return to %s after D left, got %s", k, before[k], owner)
+		}
+	}
+	if len(hash.keys) != 150 || len(hash.hashMap) != 150 {
+		t.Fatalf("virtual nodes of D not removed: %d keys", len(hash.keys))
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("A")
+	hash.AddWeighted("B", 3)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	if counts["B"] < 2*counts["A"] {
+		t.Fatalf("B with weight 3 should own more keys, got %v", counts)
+	}
+
+	hash.Remove("B")
+	if len(hash.keys) != 50 {
+		t.Fatalf("expected 50 virtual nodes after removing B, got %d", len(hash.keys))
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(2, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点: 2,4,6,12,14,16
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"3":  {"4", "6", "2"},
+		"13": {"4", "6"},
+		"17": {"2"},
+	}
+	for k, v := range testCases {
+		got := hash.GetN(k, len(v))
+		if len(got) != len(v) {
+			t.Fatalf("GetN(%s, %d) = %v, want %v", k, len(v), got, v)
+		}
+		for i := range v {
+			if got[i] != v[i] {
+				t.Errorf("GetN(%s, %d) = %v, want %v", k, len(v), got, v)
+			}
+		}
+	}
+	if got := hash.GetN("3", 10); len(got) != 3 {
+		t.Fatalf("GetN should return at most the number of nodes, got %v", got)
+	}
+}
@@ -0,0 +1,54 @@
+package consistenthash
+
+// Jump 实现 Jump Consistent Hash，不需要虚拟节点，分布均匀且几乎不占内存。
+// 节点按加入顺序编号，只有在末尾增删节点时 key 的移动量最小
+type Jump struct {
+	nodes []string
+}
+
+func NewJump() *Jump {
+	return &Jump{}
+}
+
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if j.index(node) < 0 {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+}
+
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := j.index(node); i >= 0 {
+			j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+		}
+	}
+}
+
+func (j *Jump) index(node string) int {
+	for i, n := range j.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(hash64(key), len(j.nodes))]
+}
+
+// jumpHash 见 https://arxiv.org/abs/1406.2294
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
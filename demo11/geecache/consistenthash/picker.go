@@ -0,0 +1,44 @@
+package consistenthash
+
+import (
+	"hash/fnv"
+)
+
+// Picker 将 key 映射到某个节点，Map、Jump、Rendezvous 和 Bounded 均实现了该接口
+type Picker interface {
+	Add(nodes ...string)
+	Remove(nodes ...string)
+	Get(key string) string
+}
+
+// MultiPicker 可以为 key 返回按优先级排序的多个不同节点，用于副本和故障转移
+type MultiPicker interface {
+	Picker
+	GetN(key string, n int) []string
+}
+
+var (
+	_ MultiPicker = (*Map)(nil)
+	_ MultiPicker = (*Rendezvous)(nil)
+
+	_ Picker = (*Map)(nil)
+	_ Picker = (*Jump)(nil)
+	_ Picker = (*Rendezvous)(nil)
+	_ Picker = (*Bounded)(nil)
+)
+
+func hash64(data string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(data))
+	return h.Sum64()
+}
+
+// mix64 是 splitmix64 的终结函数，用于打散 fnv 的输出
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
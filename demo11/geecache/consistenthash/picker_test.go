@@ -0,0 +1,125 @@
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var pickers = []struct {
+	name string
+	new  func() Picker
+}{
+	{"ring", func() Picker { return New(50, nil) }},
+	{"jump", func() Picker { return NewJump() }},
+	{"rendezvous", func() Picker { return NewRendezvous() }},
+	{"bounded", func() Picker { return NewBounded(50, nil, 1.25) }},
+}
+
+// distribution 将 keys 个 key 分配到 nodes 个节点上，返回每个节点分到的数量
+func distribution(p Picker, nodes, keys int) map[string]int {
+	for i := 0; i < nodes; i++ {
+		p.Add("http://localhost:" + strconv.Itoa(8001+i))
+	}
+	counts := make(map[string]int, nodes)
+	for i := 0; i < keys; i++ {
+		counts[p.Get("key"+strconv.Itoa(i))]++
+	}
+	return counts
+}
+
+// TestLoadDistribution 输出各策略下节点负载的最大值/平均值之比，go test -v 可查看
+func TestLoadDistribution(t *testing.T) {
+	const keys = 100000
+	for _, nodes := range []int{3, 10} {
+		for _, p := range pickers {
+			counts := distribution(p.new(), nodes, keys)
+			avg := float64(keys) / float64(nodes)
+			maxCount, variance := 0, 0.0
+			for _, c := range counts {
+				maxCount = max(maxCount, c)
+				variance += (float64(c) - avg) * (float64(c) - avg)
+			}
+			stddev := math.Sqrt(variance/float64(nodes)) / avg
+			ratio := float64(maxCount) / avg
+			t.Logf("%-10s nodes=%-2d max/avg=%.3f stddev=%.3f", p.name, nodes, ratio, stddev)
+
+			if len(counts) != nodes {
+				t.Errorf("%s: expected keys on %d nodes, got %d", p.name, nodes, len(counts))
+			}
+			if p.name == "bounded" && ratio > 1.25+1/avg {
+				t.Errorf("bounded: max/avg %.3f exceeds load factor", ratio)
+			}
+		}
+	}
+}
+
+func TestPickerMovement(t *testing.T) {
+	for _, p := range pickers {
+		if p.name == "bounded" {
+			continue
+		}
+		t.Run(p.name, func(t *testing.T) {
+			picker := p.new()
+			picker.Add("A", "B", "C")
+			before := make(map[string]string)
+			for i := 0; i < 1000; i++ {
+				k := "key" + strconv.Itoa(i)
+				before[k] = picker.Get(k)
+			}
+			picker.Add("D")
+			for k, owner := range before {
+				if got := picker.Get(k); got != owner && got != "D" {
+					t.Fatalf("key %s moved from %s to %s instead of D", k, owner, got)
+				}
+			}
+			picker.Remove("D")
+			for k, owner := range before {
+				if got := picker.Get(k); got != owner {
+					t.Fatalf("key %s should return to %s, got %s", k, owner, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBoundedDone(t *testing.T) {
+	b := NewBounded(50, nil, 1.25)
+	b.Add("A", "B")
+	node := b.Get("Tom")
+	if b.Load(node) != 1 {
+		t.Fatalf("Get should increase load of %s", node)
+	}
+	b.Done(node)
+	if b.Load(node) != 0 {
+		t.Fatalf("Done should release load of %s", node)
+	}
+}
+
+func TestBoundedOwner(t *testing.T) {
+	b := NewBounded(50, nil, 1)
+	b.Add("A", "B")
+	owner := b.Owner("Tom")
+	// 所有者满载后 Get 改选其他节点，Owner 不受影响
+	for i := 0; i < 10; i++ {
+		b.Get("Tom")
+	}
+	if b.Owner("Tom") != owner || b.Load("A") == 0 || b.Load("B") == 0 {
+		t.Fatalf("Owner should ignore load: owner %s, loads A=%d B=%d", b.Owner("Tom"), b.Load("A"), b.Load("B"))
+	}
+}
+
+func TestRendezvousGetN(t *testing.T) {
+	r := NewRendezvous()
+	r.Add("A", "B", "C")
+	for i := 0; i < 100; i++ {
+		k := "key" + strconv.Itoa(i)
+		nodes := r.GetN(k, 3)
+		if len(nodes) != 3 || nodes[0] != r.Get(k) {
+			t.Fatalf("GetN(%s) = %v, first should be %s", k, nodes, r.Get(k))
+		}
+		if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+			t.Fatalf("GetN(%s) returned duplicated nodes %v", k, nodes)
+		}
+	}
+}
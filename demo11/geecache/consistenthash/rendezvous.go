@@ -0,0 +1,74 @@
+package consistenthash
+
+import "sort"
+
+// Rendezvous 实现最高随机权重 (HRW) 哈希：对每个节点计算 hash(node, key)，取得分最高的节点。
+// 节点增删时只有归属于该节点的 key 会移动，Get 的开销与节点数成正比
+type Rendezvous struct {
+	nodes  []string
+	hashes []uint64
+}
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if r.index(node) < 0 {
+			r.nodes = append(r.nodes, node)
+			r.hashes = append(r.hashes, hash64(node))
+		}
+	}
+}
+
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := r.index(node); i >= 0 {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			r.hashes = append(r.hashes[:i], r.hashes[i+1:]...)
+		}
+	}
+}
+
+func (r *Rendezvous) index(node string) int {
+	for i, n := range r.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Rendezvous) Get(key string) string {
+	if len(r.nodes) == 0 {
+		return ""
+	}
+	kh := hash64(key)
+	best, bestScore := 0, uint64(0)
+	for i, nh := range r.hashes {
+		if score := mix64(kh ^ nh); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return r.nodes[best]
+}
+
+// GetN 返回得分最高的 n 个节点，按得分从高到低排序
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	kh := hash64(key)
+	idx := make([]int, len(r.nodes))
+	scores := make([]uint64, len(r.nodes))
+	for i, nh := range r.hashes {
+		idx[i], scores[i] = i, mix64(kh^nh)
+	}
+	sort.Slice(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	nodes := make([]string, 0, min(n, len(idx)))
+	for _, i := range idx[:min(n, len(idx))] {
+		nodes = append(nodes, r.nodes[i])
+	}
+	return nodes
+}
@@ -0,0 +1,333 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 每条记录的格式（小端）：
+//
+//	crc uint32 | flags uint8 | keyLen uint32 | valueLen uint32 | expire int64 | key | value
+//
+// crc 覆盖 crc 之后的所有字节，flags 为 flagDelete 时表示删除该 key
+const (
+	headerSize = 4 + 1 + 4 + 4 + 8
+	flagDelete = 1
+
+	segmentExt = ".seg"
+	// defaultSegmentBytes 在未限制总字节数时使用
+	defaultSegmentBytes = 64 << 20
+	minSegmentBytes     = 4 << 10
+)
+
+var errCorrupt = errors.New("disk: corrupt record")
+
+// Store 是由若干只追加的 segment 文件组成的磁盘存储，内存中维护 key 到记录位置的索引。
+// 总字节数超过 maxBytes 时整段删除最旧的 segment。Open 时重放所有 segment 重建索引
+type Store struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu       sync.Mutex
+	segments []*segment //按 id 从旧到新排序，最后一个为当前写入的 segment
+	index    map[string]location
+	nbytes   int64 //所有 segment 文件的总字节数
+}
+
+type segment struct {
+	id   int
+	f    *os.File
+	size int64
+	// mu 的读锁由正在读取的 Get 持有，关闭文件前需要获取写锁
+	mu sync.RWMutex
+}
+
+type location struct {
+	seg    *segment
+	offset int64 //value 在文件中的偏移
+	size   int
+	expire int64
+}
+
+// Open 打开 dir 下的存储，不存在时创建；maxBytes 为 0 表示不限制
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: defaultSegmentBytes,
+		index:        make(map[string]location),
+	}
+	if maxBytes > 0 {
+		s.segmentBytes = max(maxBytes/4, minSegmentBytes)
+	}
+
+	ids, err := segmentIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seg, err := s.openSegment(id)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if err := s.replay(seg); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if len(s.segments) == 0 {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func segmentIDs(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *Store) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%09d%s", id, segmentExt))
+}
+
+func (s *Store) openSegment(id int) (*segment, error) {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{id: id, f: f}
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+// replay 读取 segment 中的所有记录更新索引，遇到损坏或不完整的记录时从该处截断
+func (s *Store) replay(seg *segment) error {
+	info, err := seg.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(seg.f, 0, info.Size()))
+	var offset int64
+	for {
+		key, flags, valueSize, expire, n, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err := seg.f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		s.apply(key, flags, location{seg: seg, offset: offset + int64(n-valueSize), size: valueSize, expire: expire})
+		offset += int64(n)
+	}
+	seg.size = offset
+	s.nbytes += offset
+	return nil
+}
+
+// readRecord 读取一条记录，返回记录的总长度 n。remaining 是 segment 中剩余的字节数，
+// 在分配内存之前用它检查头部中的长度，避免损坏的头部申请过大的内存
+func readRecord(r *bufio.Reader, remaining int64) (key string, flags byte, valueSize int, expire int64, n int, err error) {
+	var header [headerSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errCorrupt
+		}
+		return
+	}
+	sum := binary.LittleEndian.Uint32(header[0:])
+	flags = header[4]
+	keySize := int(binary.LittleEndian.Uint32(header[5:]))
+	valueSize = int(binary.LittleEndian.Uint32(header[9:]))
+	expire = int64(binary.LittleEndian.Uint64(header[13:]))
+
+	if int64(keySize)+int64(valueSize) > remaining-headerSize {
+		err = errCorrupt
+		return
+	}
+	body := make([]byte, keySize+valueSize)
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = errCorrupt
+		return
+	}
+	h := crc32.NewIEEE()
+	h.Write(header[4:])
+	h.Write(body)
+	if h.Sum32() != sum {
+		err = errCorrupt
+		return
+	}
+	return string(body[:keySize]), flags, valueSize, expire, headerSize + len(body), nil
+}
+
+func encodeRecord(key string, value []byte, expire int64, flags byte) []byte {
+	buf := make([]byte, headerSize+len(key)+len(value))
+	buf[4] = flags
+	binary.LittleEndian.PutUint32(buf[5:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[9:], uint32(len(value)))
+	binary.LittleEndian.PutUint64(buf[13:], uint64(expire))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf[0:], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func (s *Store) apply(key string, flags byte, loc location) {
+	if flags&flagDelete != 0 {
+		delete(s.index, key)
+		return
+	}
+	s.index[key] = loc
+}
+
+// Put 追加一条记录，expire 为 UnixNano，0 表示永不过期
+func (s *Store) Put(key string, value []byte, expire int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(key, value, expire, 0)
+}
+
+// Delete 追加一条删除记录，key 不存在时不做任何事
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	return s.append(key, nil, 0, flagDelete)
+}
+
+func (s *Store) append(key string, value []byte, expire int64, flags byte) error {
+	seg := s.segments[len(s.segments)-1]
+	if seg.size >= s.segmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+	buf := encodeRecord(key, value, expire, flags)
+	if _, err := seg.f.WriteAt(buf, seg.size); err != nil {
+		return err
+	}
+	s.apply(key, flags, location{seg: seg, offset: seg.size + int64(len(buf)-len(value)), size: len(value), expire: expire})
+	seg.size += int64(len(buf))
+	s.nbytes += int64(len(buf))
+	return s.evict()
+}
+
+// rotate 新建一个 segment 作为当前写入的 segment
+func (s *Store) rotate() error {
+	id := 1
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	}
+	_, err := s.openSegment(id)
+	return err
+}
+
+// evict 删除最旧的 segment 直到总字节数不超过 maxBytes，当前写入的 segment 不会被删除
+func (s *Store) evict() error {
+	for s.maxBytes > 0 && s.nbytes > s.maxBytes && len(s.segments) > 1 {
+		seg := s.segments[0]
+		s.segments = s.segments[1:]
+		for key, loc := range s.index {
+			if loc.seg == seg {
+				delete(s.index, key)
+			}
+		}
+		s.nbytes -= seg.size
+		seg.close()
+		if err := os.Remove(s.segmentPath(seg.id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get 返回 key 对应的值和过期时间
+func (s *Store) Get(key string) (value []byte, expire int64, ok bool, err error) {
+	s.mu.Lock()
+	loc, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return nil, 0, false, nil
+	}
+	// 在释放 s.mu 之前锁住 segment，保证读取期间文件不会被 evict 关闭
+	loc.seg.mu.RLock()
+	s.mu.Unlock()
+	defer loc.seg.mu.RUnlock()
+	value = make([]byte, loc.size)
+	if _, err := loc.seg.f.ReadAt(value, loc.offset); err != nil {
+		return nil, 0, false, err
+	}
+	return value, loc.expire, true, nil
+}
+
+// Len 返回存储中的 key 数量
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Bytes 返回所有 segment 文件的总字节数
+func (s *Store) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nbytes
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, seg := range s.segments {
+		if e := seg.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.segments = nil
+	return err
+}
+
+// close 等待正在进行的读取结束后关闭文件
+func (seg *segment) close() error {
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+	return seg.f.Close()
+}
@@ -0,0 +1,171 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPutGet(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("key1", []byte("1234"), 42)
+	if v, expire, ok, err := s.Get("key1"); err != nil || !ok || string(v) != "1234" || expire != 42 {
+		t.Fatalf("get key1 failed: %q %d %v %v", v, expire, ok, err)
+	}
+	s.Put("key1", []byte("5678"), 0)
+	if v, _, _, _ := s.Get("key1"); string(v) != "5678" {
+		t.Fatalf("overwrite key1 failed, got %q", v)
+	}
+	s.Delete("key1")
+	if _, _, ok, _ := s.Get("key1"); ok || s.Len() != 0 {
+		t.Fatalf("delete key1 failed")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("key1", []byte("v1"), 0)
+	s.Put("key2", []byte("v2"), 0)
+	s.Delete("key1")
+	s.Close()
+
+	s, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, _, ok, _ := s.Get("key1"); ok {
+		t.Fatalf("deleted key1 should stay deleted after reopen")
+	}
+	if v, _, ok, _ := s.Get("key2"); !ok || string(v) != "v2" {
+		t.Fatalf("key2 should survive reopen, got %q", v)
+	}
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("key1", []byte("v1"), 0)
+	s.Put("key2", []byte("v2"), 0)
+	size := s.Bytes()
+	s.Close()
+
+	path := filepath.Join(dir, fmt.Sprintf("%09d%s", 1, segmentExt))
+	if err := os.Truncate(path, size-1); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, _, ok, _ := s.Get("key2"); ok {
+		t.Fatalf("truncated key2 should be dropped")
+	}
+	if v, _, ok, _ := s.Get("key1"); !ok || string(v) != "v1" {
+		t.Fatalf("key1 should survive truncation, got %q", v)
+	}
+	s.Put("key3", []byte("v3"), 0)
+	if v, _, ok, _ := s.Get("key3"); !ok || string(v) != "v3" {
+		t.Fatalf("append after truncation failed, got %q", v)
+	}
+}
+
+func TestCorruptHeader(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("key1", []byte("v1"), 0)
+	offset := s.Bytes()
+	s.Put("key2", []byte("v2"), 0)
+	s.Close()
+
+	// 将 key2 的 valueLen 改为 0xffffffff，重放时不应按它分配内存
+	path := filepath.Join(dir, fmt.Sprintf("%09d%s", 1, segmentExt))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, offset+9); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, _, ok, _ := s.Get("key2"); ok || s.Bytes() != offset {
+		t.Fatalf("corrupt record should be truncated, size %d want %d", s.Bytes(), offset)
+	}
+	if v, _, ok, _ := s.Get("key1"); !ok || string(v) != "v1" {
+		t.Fatalf("key1 should survive, got %q", v)
+	}
+}
+
+func TestGetDuringEvict(t *testing.T) {
+	s, err := Open(t.TempDir(), minSegmentBytes*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	value := make([]byte, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			s.Put(fmt.Sprintf("key%d", i), value, 0)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		for i := 0; i < 1000; i += 50 {
+			if _, _, _, err := s.Get(fmt.Sprintf("key%d", i)); err != nil {
+				t.Fatalf("Get raced with evict: %v", err)
+			}
+		}
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	const maxBytes = 16 << 10
+	s, err := Open(t.TempDir(), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	value := make([]byte, 100)
+	for i := 0; i < 1000; i++ {
+		if err := s.Put(fmt.Sprintf("key%d", i), value, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Bytes() > maxBytes {
+		t.Fatalf("store should respect maxBytes, got %d", s.Bytes())
+	}
+	if _, _, ok, _ := s.Get("key0"); ok {
+		t.Fatalf("oldest key should be evicted")
+	}
+	if _, _, ok, _ := s.Get("key999"); !ok {
+		t.Fatalf("newest key should be kept")
+	}
+}
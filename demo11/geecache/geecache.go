@@ -1,10 +1,16 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/zsm/demo11/geecache/disk"
 	pb "github.com/zsm/demo11/geecache/geecachepb"
 	"github.com/zsm/demo11/geecache/singleflight"
 )
@@ -19,65 +25,291 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// ContextGetter 是 Getter 的可选扩展，加载数据时可以感知调用方的超时和取消
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// TTLGetter 是 Getter 的可选扩展，用于为单个 key 指定过期时间，
+// 返回的 ttl 为 0 时沿用 Group 的默认 TTL
+type TTLGetter interface {
+	GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+type TTLGetterFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	return f.GetContext(context.Background(), key)
+}
+
+func (f TTLGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	b, _, err := f(ctx, key)
+	return b, err
+}
+
+func (f TTLGetterFunc) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
 type Group struct {
-	name      string
-	getter    Getter
-	mainCache cache
-	peers     PeerPicker
-	loader    *singleflight.Group
+	name       string
+	getter     Getter
+	cacheBytes atomic.Int64
+	budget     *Budget // 不为 nil 时 cacheBytes 由 Budget 分配
+	mainCache  cache
+	// hotCache 保存从 peer 获取、但并不归本节点所有的热点数据，
+	// 避免所有节点都去请求同一个 peer
+	hotCache cache
+	// negCache 保存 not-found 结果，只有设置了 negativeTTL 才会使用
+	negCache    cache
+	negativeTTL time.Duration
+	// compression 不为 Identity 时 mainCache 压缩保存不小于 compressMinSize 的 value
+	compression     Encoding
+	compressMinSize int
+	refreshAhead    float64
+	refreshing      sync.Map // 正在后台刷新的 key
+	peers           PeerPicker
+	loader          *singleflight.Group
+	ttl             time.Duration
+	stats           groupStats
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+type CacheType int
+
+const (
+	MainCache CacheType = iota + 1
+	HotCache
+)
+
+const (
+	// hotCacheFraction 表示 hotCache 占 cacheBytes 的比例为 1/hotCacheFraction
+	hotCacheFraction = 8
 )
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// hotCacheOdds 表示从 peer 获取的数据有 1/hotCacheOdds 的概率放入 hotCache
+var hotCacheOdds = 10
+
+type GroupOption func(*Group)
+
+// WithTTL 为 Group 中的所有条目设置默认过期时间
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithShards 将 mainCache 和 hotCache 分别拆分为 n 个 shard，
+// 每个 shard 拥有独立的锁和 1/n 的字节上限。默认按 GOMAXPROCS 分片，WithShards(1) 关闭分片
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.nshards = n
+		g.hotCache.nshards = n
+	}
+}
+
+// WithCleanupInterval 设置后台清理过期条目的间隔
+func WithCleanupInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.cleanupInterval = interval
+		g.hotCache.cleanupInterval = interval
+		g.negCache.cleanupInterval = interval
+	}
+}
+
+// WithDiskStore 为 mainCache 增加磁盘层，被淘汰的条目写入 store，
+// 进程重启后重新打开同一目录即可读回之前写入的条目
+func WithDiskStore(store *disk.Store) GroupOption {
+	return func(g *Group) {
+		g.mainCache.disk = store
+	}
+}
+
+// WithPeerPicker 为 Group 单独指定 PeerPicker，与创建后调用 RegisterPeers 等价
+func WithPeerPicker(peers PeerPicker) GroupOption {
+	return func(g *Group) {
+		g.peers = peers
+	}
+}
+
+// NewGroup 在 DefaultRegistry 中创建 Group，同名的 Group 会被关闭并替换，
+// 需要在重名时报错请使用 Registry.NewGroup
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g := newGroup(name, cacheBytes, getter, opts...)
+	if old := DefaultRegistry.put(g); old != nil {
+		log.Printf("[GeeCache] group %s registered more than once, replacing the old one", name)
+		old.close()
+	}
+	return g
+}
+
+func GetGroup(name string) *Group {
+	return DefaultRegistry.Get(name)
+}
+
+func newGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:   name,
+		getter: getter,
+		loader: &singleflight.Group{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.cacheBytes.Store(cacheBytes)
+	g.mainCache.cacheBytes, g.hotCache.cacheBytes, g.negCache.cacheBytes = g.splitBytes(cacheBytes)
+	if g.budget != nil {
+		g.budget.add(g, cacheBytes)
 	}
-	groups[name] = g
 	return g
 }
 
-func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+// splitBytes 将 cacheBytes 分给 mainCache、hotCache 和负缓存。
+// cacheBytes 很小时 mainCache 和负缓存至少分到 1 字节，避免 0 被当作不限制
+func (g *Group) splitBytes(cacheBytes int64) (mainBytes, hotBytes, negBytes int64) {
+	hotBytes = cacheBytes / hotCacheFraction
+	mainBytes = cacheBytes - hotBytes
+	if g.negativeTTL > 0 {
+		negBytes = mainBytes / negativeCacheFraction
+		if cacheBytes > 0 {
+			negBytes = max(negBytes, 1)
+		}
+		mainBytes -= negBytes
+	}
+	if cacheBytes > 0 {
+		mainBytes = max(mainBytes, 1)
+	}
+	return
+}
+
+// CacheBytes 返回 Group 当前的字节上限
+func (g *Group) CacheBytes() int64 {
+	return g.cacheBytes.Load()
+}
+
+// SetCacheBytes 在运行时修改 Group 的字节上限，缩小时立即淘汰超出的条目。
+// 加入 Budget 的 Group 修改的是它能从 Budget 分到的最大值，实际上限由 Budget 重新分配
+func (g *Group) SetCacheBytes(cacheBytes int64) {
+	if g.budget != nil && g.budget.setMax(g, cacheBytes) {
+		return
+	}
+	g.resize(cacheBytes)
+}
+
+// resize 修改 Group 当前的字节上限，Budget 分配时直接调用
+func (g *Group) resize(cacheBytes int64) {
+	g.cacheBytes.Store(cacheBytes)
+	mainBytes, hotBytes, negBytes := g.splitBytes(cacheBytes)
+	g.mainCache.resize(mainBytes)
+	g.hotCache.resize(hotBytes)
+	g.negCache.resize(negBytes)
+}
+
+// close 停止 Group 的后台清理，由 Registry 在移除 Group 时调用
+func (g *Group) close() {
+	if g.budget != nil {
+		g.budget.remove(g)
+	}
+	g.mainCache.close()
+	g.hotCache.close()
+	g.negCache.close()
 }
 
-func (g *Group) getLocally(key string) (BytesView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (BytesView, error) {
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	switch getter := g.getter.(type) {
+	case TTLGetter:
+		bytes, ttl, err = getter.GetWithTTL(ctx, key)
+	case ContextGetter:
+		bytes, err = getter.GetContext(ctx, key)
+	default:
+		bytes, err = getter.Get(key)
+	}
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		g.cacheNegative(key, err)
 		return BytesView{}, err
 	}
-	value := BytesView{b: cloneBytes(bytes)}
+	g.stats.localLoads.Add(1)
+	value := g.compress(BytesView{b: cloneBytes(bytes), e: g.expireAt(ttl), ttl: ttl})
 	g.populateCache(key, value)
 	return value, nil
 }
 
+// expireAt 计算过期时间，ttl 为 0 时使用 Group 的默认 TTL
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
 func (g *Group) populateCache(key string, value BytesView) {
-	g.mainCache.add(key, value)
+	g.mainCache.add(key, g.compress(value))
+}
+
+func (g *Group) lookupCache(key string) (BytesView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, true
+	}
+	return g.hotCache.get(key)
+}
+
+// CacheStats 返回 mainCache 或 hotCache 的统计信息
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
 }
 
 func (g *Group) Get(key string) (BytesView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，但 ctx 被取消或超时后立即返回，
+// 当所有等待同一个 key 的调用方都放弃时，正在进行的加载也会被取消
+func (g *Group) GetContext(ctx context.Context, key string) (BytesView, error) {
+	g.stats.gets.Add(1)
 	if key == "" {
 		return BytesView{}, fmt.Errorf("key is required")
 	}
-	if v, ok := g.mainCache.get(key); ok {
+	if v, ok := g.lookupCache(key); ok {
+		g.stats.cacheHits.Add(1)
 		log.Println("[GeeCache] hit")
+		if g.needsRefresh(v) {
+			g.refreshAsync(key)
+		}
 		return v, nil
 	}
-	return g.load(key)
+	if err := g.lookupNegative(key); err != nil {
+		g.stats.cacheHits.Add(1)
+		return BytesView{}, err
+	}
+	return g.load(ctx, key)
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -87,18 +319,11 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-func (g *Group) load(key string) (value BytesView, err error) {
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				}
-				log.Println("[GeeCache] Failed to get from peer", err)
-			}
-		}
-		return g.getLocally(key)
-
+func (g *Group) load(ctx context.Context, key string) (value BytesView, err error) {
+	g.stats.loads.Add(1)
+	viewi, err, _ := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		g.stats.loadsDeduped.Add(1)
+		return g.loadFromOwners(ctx, key)
 	})
 	if err == nil {
 		return viewi.(BytesView), nil
@@ -106,15 +331,64 @@ func (g *Group) load(key string) (value BytesView, err error) {
 	return
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (BytesView, error) {
+// loadFromOwners 依次尝试 key 的远程所有者，都失败或 key 归本节点所有时通过 Getter 加载
+func (g *Group) loadFromOwners(ctx context.Context, key string) (BytesView, error) {
+	for _, peer := range g.pickOwners(ctx, key) {
+		value, err := g.getFromPeer(ctx, peer, key)
+		if err == nil {
+			g.stats.peerLoads.Add(1)
+			if g.hotCache.capacity() > 0 && rand.Intn(hotCacheOdds) == 0 {
+				g.hotCache.add(key, value)
+			}
+			return value, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			// 所有者确认 key 不存在，不再尝试其他节点
+			g.stats.peerLoads.Add(1)
+			g.cacheNegative(key, err)
+			return BytesView{}, err
+		}
+		g.stats.peerErrors.Add(1)
+		if ctx.Err() != nil {
+			return BytesView{}, ctx.Err()
+		}
+		log.Println("[GeeCache] Failed to get from peer", err)
+	}
+	return g.getLocally(ctx, key)
+}
+
+// pickOwners 返回需要依次尝试的远程所有者，为空表示应在本地加载，
+// 由其他节点转发来的请求总在本地加载
+func (g *Group) pickOwners(ctx context.Context, key string) []PeerGetter {
+	if g.peers == nil || isPeerRequest(ctx) {
+		return nil
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		return rp.PickPeers(key)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return nil
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (BytesView, error) {
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:          g.name,
+		Key:            key,
+		AcceptEncoding: acceptEncodings,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peerGet(ctx, peer, req, res)
 	if err != nil {
 		return BytesView{}, err
 	}
-	return BytesView{b: res.Value}, nil
+	if res.Status == pb.Status_NOT_FOUND {
+		return BytesView{}, &notFoundError{msg: res.Error}
+	}
+	e := expireTime(res.Expire)
+	if res.Expire == 0 {
+		e = g.expireAt(0)
+	}
+	return peerValue(res.Value, res.Encoding, e, valueLimit(peer))
 }
@@ -1,10 +1,23 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	pb "github.com/zsm/demo11/geecache/geecachepb"
 )
 
 var db = map[string]string{
@@ -64,3 +77,1036 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil,but %s got", group.name)
 	}
 }
+
+func TestGetExpired(t *testing.T) {
+	loads := 0
+	gee := NewGroup("ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithTTL(20*time.Millisecond))
+
+	if _, err := gee.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("failed to load Tom")
+	}
+	if _, err := gee.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("cache Tom miss")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := gee.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expired Tom should be reloaded, loads=%d", loads)
+	}
+}
+
+func TestTTLGetter(t *testing.T) {
+	gee := NewGroup("ttl-getter", 2<<10, TTLGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			if key == "short" {
+				return []byte(key), 10 * time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(time.Hour), WithCleanupInterval(5*time.Millisecond))
+
+	short, _ := gee.Get("short")
+	long, _ := gee.Get("long")
+	if d := time.Until(short.Expire()); d <= 0 || d > 10*time.Millisecond {
+		t.Fatalf("per-key ttl not applied, expire in %v", d)
+	}
+	if d := time.Until(long.Expire()); d < 59*time.Minute {
+		t.Fatalf("group ttl not applied, expire in %v", d)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n := gee.CacheStats(MainCache).Items; n != 1 {
+		t.Fatalf("janitor should have removed short, %d entries left", n)
+	}
+}
+
+func TestGetContextCanceled(t *testing.T) {
+	canceled := make(chan struct{})
+	gee := NewGroup("slow", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("getter was not canceled after the caller gave up")
+	}
+}
+
+// fakePeer 同时充当 PeerPicker 和唯一的远程 PeerGetter
+type fakePeer struct {
+	local                                     bool // 为 true 时所有 key 都归本节点所有
+	gets, batches, sets, removes, invalidates int
+}
+
+func (p *fakePeer) PickPeer(key string) (PeerGetter, bool) {
+	if p.local {
+		return nil, false
+	}
+	return p, true
+}
+
+func (p *fakePeer) GetAll() []PeerGetter {
+	return []PeerGetter{p}
+}
+
+func (p *fakePeer) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.batches++
+	for _, key := range in.GetKeys() {
+		item := &pb.BatchItem{Key: key, Value: []byte(db[key])}
+		if _, ok := db[key]; !ok {
+			item.Error = key + " not exist"
+			item.Status = pb.Status_NOT_FOUND
+		}
+		out.Items = append(out.Items, item)
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.SetRequest, out *pb.Ack) error {
+	p.sets++
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	p.removes++
+	return nil
+}
+
+func (p *fakePeer) Invalidate(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	p.invalidates++
+	return nil
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p *fakePeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	v, ok := db[in.GetKey()]
+	if !ok {
+		out.Status = pb.Status_NOT_FOUND
+		out.Error = in.GetKey() + " not exist"
+	}
+	out.Value = []byte(v)
+	return nil
+}
+
+// basicPeer 只实现最基本的 PeerGetter 和 PeerPicker
+type basicPeer struct{}
+
+func (p basicPeer) PickPeer(key string) (PeerGetter, bool) { return p, true }
+
+func (p basicPeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value = []byte("remote:" + in.GetKey())
+	return nil
+}
+
+func TestBasicPeer(t *testing.T) {
+	gee := NewGroup("basic-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from the peer", key)
+			return nil, nil
+		}))
+	gee.RegisterPeers(basicPeer{})
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "remote:Tom" {
+		t.Fatalf("Get = %v, %v", view, err)
+	}
+	values, errs := gee.GetMany([]string{"Jack", "Sam"})
+	if errs[0] != nil || values[0].String() != "remote:Jack" || values[1].String() != "remote:Sam" {
+		t.Fatalf("GetMany = %v, %v", values, errs)
+	}
+	if err := gee.Set("Tom", []byte("x")); err == nil {
+		t.Fatal("Set through a peer without PeerSetter should fail")
+	}
+}
+
+func TestPeerRequestLoadsLocally(t *testing.T) {
+	gee := newGroup("peer-request", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local:" + key), nil
+		}), WithPeerPicker(basicPeer{}))
+	ctx := withPeerRequest(context.Background())
+	if view, err := gee.GetContext(ctx, "Tom"); err != nil || view.String() != "local:Tom" {
+		t.Fatalf("forwarded Get should load locally, got %v, %v", view, err)
+	}
+	values, errs := gee.GetManyContext(ctx, []string{"Jack"})
+	if errs[0] != nil || values[0].String() != "local:Jack" {
+		t.Fatalf("forwarded GetMany should load locally, got %v, %v", values, errs)
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	defer func(odds int) { hotCacheOdds = odds }(hotCacheOdds)
+	hotCacheOdds = 1
+
+	peer := &fakePeer{}
+	gee := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from peer", key)
+			return nil, nil
+		}))
+	gee.RegisterPeers(peer)
+
+	for i := 0; i < 3; i++ {
+		if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("failed to get Tom from peer")
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("hot key should be fetched from peer once, got %d", peer.gets)
+	}
+	if s := gee.CacheStats(HotCache); s.Hits != 2 || s.Items != 1 {
+		t.Fatalf("unexpected hot cache stats %+v", s)
+	}
+	if s := gee.CacheStats(MainCache); s.Hits != 0 || s.Misses != 3 {
+		t.Fatalf("unexpected main cache stats %+v", s)
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	peer := &fakePeer{local: true}
+	gee := NewGroup("set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db"), nil
+		}))
+	gee.RegisterPeers(peer)
+
+	if err := gee.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get("Tom"); view.String() != "700" || peer.invalidates != 1 {
+		t.Fatalf("Set on owner should store locally and broadcast invalidation")
+	}
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get("Tom"); view.String() != "db" || peer.invalidates != 2 {
+		t.Fatalf("Remove on owner should drop the value and broadcast invalidation")
+	}
+
+	peer.local = false
+	if err := gee.Set("Sam", []byte("1")); err != nil || peer.sets != 1 {
+		t.Fatalf("Set should be routed to the owner")
+	}
+	if err := gee.Remove("Sam"); err != nil || peer.removes != 1 {
+		t.Fatalf("Remove should be routed to the owner")
+	}
+}
+
+type failingPeer struct {
+	fakePeer
+}
+
+func (p *failingPeer) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	return fmt.Errorf("peer down")
+}
+
+func (p *failingPeer) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.batches++
+	return fmt.Errorf("peer down")
+}
+
+type replicaPicker []PeerGetter
+
+func (r replicaPicker) PickPeer(key string) (PeerGetter, bool) { return r[0], true }
+func (r replicaPicker) GetAll() []PeerGetter                   { return r }
+func (r replicaPicker) PickPeers(key string) []PeerGetter      { return r }
+
+func TestLoadFailover(t *testing.T) {
+	primary, secondary := &failingPeer{}, &fakePeer{}
+	gee := NewGroup("failover", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from the secondary owner", key)
+			return nil, nil
+		}))
+	gee.RegisterPeers(replicaPicker{primary, secondary})
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("failed to get Tom from secondary owner: %v", err)
+	}
+	if primary.gets != 1 || secondary.gets != 1 {
+		t.Fatalf("expected primary then secondary to be tried, got %d %d", primary.gets, secondary.gets)
+	}
+	if s := gee.Stats(); s.PeerErrors != 1 || s.PeerLoads != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	calls := 0
+	fn := func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("attempt %d failed", calls)
+		}
+		return nil
+	}
+	if err := (RetryPolicy{Attempts: 3, Backoff: time.Millisecond}).do(context.Background(), fn); err != nil || calls != 3 {
+		t.Fatalf("expected success on third attempt, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	if err := (RetryPolicy{Attempts: 2}).do(context.Background(), fn); err == nil || calls != 2 {
+		t.Fatalf("expected failure after 2 attempts, got %v after %d calls", err, calls)
+	}
+
+	for code, want := range map[int]int{http.StatusNotFound: 1, http.StatusRequestEntityTooLarge: 1, http.StatusTooManyRequests: 3, http.StatusBadGateway: 3} {
+		calls = 0
+		err := (RetryPolicy{Attempts: 3}).do(context.Background(), func() error {
+			calls++
+			return &statusError{code: code, status: http.StatusText(code)}
+		})
+		if err == nil || calls != want {
+			t.Fatalf("status %d: expected %d calls, got %d", code, want, calls)
+		}
+	}
+
+	calls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := (RetryPolicy{Attempts: 10, Backoff: time.Second}).do(ctx, fn); err == nil || calls != 1 {
+		t.Fatalf("backoff should stop when ctx is done, got %v after %d calls", err, calls)
+	}
+}
+
+// prefixPicker 将以 "remote" 开头的 key 交给 peer，其余 key 归本节点所有
+type prefixPicker struct {
+	peer PeerGetter
+}
+
+func (p prefixPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+func (p prefixPicker) GetAll() []PeerGetter { return []PeerGetter{p.peer} }
+
+func TestGetMany(t *testing.T) {
+	peer := &fakePeer{}
+	batchCalls := 0
+	gee := NewGroup("batch", 2<<10, BatchGetterFunc(
+		func(ctx context.Context, keys []string) ([][]byte, []error) {
+			batchCalls++
+			values, errs := make([][]byte, len(keys)), make([]error, len(keys))
+			for i, key := range keys {
+				if v, ok := db[key]; ok {
+					values[i] = []byte(v)
+				} else {
+					errs[i] = fmt.Errorf("%s not exist", key)
+				}
+			}
+			return values, errs
+		}))
+	gee.RegisterPeers(prefixPicker{peer})
+	db["remoteA"], db["remoteB"] = "1", "2"
+	defer func() { delete(db, "remoteA"); delete(db, "remoteB") }()
+
+	gee.Get("Tom")
+	keys := []string{"Tom", "Jack", "Sam", "remoteA", "remoteB", "remoteC", "unknown", "", "Jack"}
+	values, errs := gee.GetMany(keys)
+
+	expect := []string{"630", "589", "567", "1", "2", "", "", "", "589"}
+	for i, key := range keys {
+		if (errs[i] != nil) != (expect[i] == "") || values[i].String() != expect[i] {
+			t.Errorf("GetMany %q = %q, %v; want %q", key, values[i], errs[i], expect[i])
+		}
+	}
+	if peer.batches != 1 || batchCalls != 2 {
+		t.Fatalf("expected 1 peer batch and 2 getter batches, got %d and %d", peer.batches, batchCalls)
+	}
+}
+
+func TestGetManyBadBatchGetter(t *testing.T) {
+	gee := NewGroup("batch-bad", 2<<10, BatchGetterFunc(
+		func(ctx context.Context, keys []string) ([][]byte, []error) {
+			return nil, nil
+		}))
+	values, errs := gee.GetMany([]string{"Tom", "Jack"})
+	if len(values) != 2 || errs[0] == nil || errs[1] == nil {
+		t.Fatalf("mismatched batch results should fail every key, got %v", errs)
+	}
+	if _, err := gee.Get("Sam"); err == nil {
+		t.Fatal("Get through a mismatched BatchGetter should fail")
+	}
+}
+
+func TestGetManyFailover(t *testing.T) {
+	primary, secondary := &failingPeer{}, &fakePeer{}
+	gee := NewGroup("batch-failover", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from the secondary owner", key)
+			return nil, nil
+		}))
+	gee.RegisterPeers(replicaPicker{primary, secondary})
+
+	values, errs := gee.GetMany([]string{"Tom", "Jack"})
+	if errs[0] != nil || errs[1] != nil || values[0].String() != "630" || values[1].String() != "589" {
+		t.Fatalf("GetMany = %v, %v", values, errs)
+	}
+	if primary.batches != 1 || secondary.batches != 1 {
+		t.Fatalf("expected one batch to each owner, got %d and %d", primary.batches, secondary.batches)
+	}
+}
+
+// partialPeer 只实现 PeerGetter，请求 fail 中的 key 时返回错误，记录成功返回的 key
+type partialPeer struct {
+	fail   string
+	mu     sync.Mutex
+	served []string
+}
+
+func (p *partialPeer) Get(in *pb.Request, out *pb.Response) error {
+	if in.GetKey() == p.fail {
+		return fmt.Errorf("peer down")
+	}
+	p.mu.Lock()
+	p.served = append(p.served, in.GetKey())
+	p.mu.Unlock()
+	out.Value = []byte(db[in.GetKey()])
+	return nil
+}
+
+func TestGetManyFailoverMissingKeys(t *testing.T) {
+	primary, secondary := &partialPeer{fail: "Jack"}, &partialPeer{}
+	gee := NewGroup("batch-failover-missing", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from a peer", key)
+			return nil, nil
+		}))
+	gee.RegisterPeers(replicaPicker{primary, secondary})
+
+	keys := []string{"Tom", "Jack", "Sam"}
+	values, errs := gee.GetMany(keys)
+	for i, key := range keys {
+		if errs[i] != nil || values[i].String() != db[key] {
+			t.Fatalf("GetMany %s = %v, %v", key, values[i], errs[i])
+		}
+	}
+	if !slices.Contains(secondary.served, "Jack") {
+		t.Fatalf("Jack should fail over to the secondary, got %v", secondary.served)
+	}
+	for _, key := range primary.served {
+		if slices.Contains(secondary.served, key) {
+			t.Fatalf("%s was already fetched from the primary but requested again", key)
+		}
+	}
+}
+
+// itemErrorPeer 在批量响应中对 fail 返回错误，其余 key 与 fakePeer 相同
+type itemErrorPeer struct {
+	fakePeer
+	fail string
+}
+
+func (p *itemErrorPeer) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.fakePeer.GetMany(ctx, in, out)
+	for _, item := range out.Items {
+		if item.Key == p.fail {
+			item.Value, item.Error, item.Status = nil, "owner failed", pb.Status_OK
+		}
+	}
+	return nil
+}
+
+func TestGetManyItemErrorFallsBack(t *testing.T) {
+	peer := &itemErrorPeer{fail: "remoteB"}
+	gee := NewGroup("batch-item-error", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local:" + key), nil
+		}))
+	gee.RegisterPeers(prefixPicker{peer})
+	db["remoteA"] = "1"
+	defer delete(db, "remoteA")
+
+	values, errs := gee.GetMany([]string{"remoteA", "remoteB"})
+	if errs[0] != nil || values[0].String() != "1" {
+		t.Fatalf("remoteA = %v, %v", values[0], errs[0])
+	}
+	if errs[1] != nil || values[1].String() != "local:remoteB" {
+		t.Fatalf("remoteB should fall back to the local getter, got %v, %v", values[1], errs[1])
+	}
+	if s := gee.Stats(); s.PeerErrors != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestGetManySingleflight(t *testing.T) {
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gee := NewGroup("batch-singleflight", 2<<10, BatchGetterFunc(
+		func(ctx context.Context, keys []string) ([][]byte, []error) {
+			if loads.Add(int32(len(keys))) == 1 {
+				close(started)
+			}
+			<-release
+			values := make([][]byte, len(keys))
+			for i, key := range keys {
+				values[i] = []byte(db[key])
+			}
+			return values, make([]error, len(keys))
+		}))
+
+	done := make(chan []BytesView)
+	go func() {
+		values, _ := gee.GetMany([]string{"Tom"})
+		done <- values
+	}()
+	<-started
+	get := make(chan BytesView)
+	go func() {
+		view, _ := gee.Get("Tom")
+		get <- view
+	}()
+	waitFor(t, func() bool { return gee.Stats().Loads == 2 })
+	close(release)
+	if values := <-done; values[0].String() != "630" {
+		t.Fatalf("GetMany = %v", values)
+	}
+	if view := <-get; view.String() != "630" {
+		t.Fatalf("Get = %v", view)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("Tom was loaded %d times, want 1", n)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	src := NewGroup("snapshot-src", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	for k := range db {
+		src.Get(k)
+	}
+	src.mainCache.add("expired", BytesView{b: []byte("x"), e: time.Now().Add(-time.Second)})
+
+	var buf bytes.Buffer
+	if n, err := src.WriteSnapshot(&buf); err != nil || n != len(db) {
+		t.Fatalf("write snapshot: n=%d err=%v", n, err)
+	}
+	snapshot := buf.Bytes()
+
+	loads := 0
+	dst := NewGroup("snapshot-dst", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	if n, err := dst.ReadSnapshot(bytes.NewReader(snapshot)); err != nil || n != len(db) {
+		t.Fatalf("read snapshot: n=%d err=%v", n, err)
+	}
+	for k, v := range db {
+		if view, err := dst.Get(k); err != nil || view.String() != v {
+			t.Fatalf("warm cache miss %s", k)
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("warm cache should not hit the getter, got %d loads", loads)
+	}
+
+	corrupt := append([]byte(nil), snapshot...)
+	corrupt[len(snapshotMagic)+3] ^= 0xff
+	if _, err := dst.ReadSnapshot(bytes.NewReader(corrupt)); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("corrupt snapshot should fail, got %v", err)
+	}
+	if _, err := dst.ReadSnapshot(bytes.NewReader(snapshot[:len(snapshot)-1])); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("truncated snapshot should fail, got %v", err)
+	}
+	if _, err := dst.ReadSnapshot(strings.NewReader("GCSN\x02")); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("unknown version should fail, got %v", err)
+	}
+	// 长度字段声称有 512 MiB，但后面只有几个字节
+	forged := binary.AppendUvarint([]byte("GCSN\x01\x01"), 512<<20)
+	if _, err := dst.ReadSnapshot(bytes.NewReader(append(forged, "key"...))); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("forged length should fail, got %v", err)
+	}
+	if _, err := dst.readSnapshot(bytes.NewReader(snapshot), 2); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("records over the limit should fail, got %v", err)
+	}
+}
+
+func TestSnapshotCompression(t *testing.T) {
+	large := strings.Repeat("geecache", 100)
+	src := NewGroup("snapshot-plain", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(large), nil
+		}))
+	src.Get("large")
+	var buf bytes.Buffer
+	if _, err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewGroup("snapshot-compressed", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithCompression(Gzip, 64))
+	if _, err := dst.ReadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := dst.CacheStats(MainCache); s.Items != 1 || s.Bytes >= int64(len(large)) {
+		t.Fatalf("snapshot entries should be compressed on import, got %+v", s)
+	}
+	if v, err := dst.Get("large"); err != nil || v.String() != large {
+		t.Fatalf("Get after import = %v", err)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	transient := true
+	gee := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "flaky" {
+				if transient {
+					return nil, errors.New("db unavailable")
+				}
+				return []byte("ok"), nil
+			}
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), WithNegativeTTL(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, ErrNotFound) || !strings.HasPrefix(err.Error(), "unknown not exist") {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+	if loads != 1 || gee.Stats().NegativeHits != 2 {
+		t.Fatalf("not-found should be cached, got %d loads %+v", loads, gee.Stats())
+	}
+
+	gee.Get("flaky")
+	transient = false
+	if v, err := gee.Get("flaky"); err != nil || v.String() != "ok" {
+		t.Fatalf("transient errors should not be cached, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("unknown")
+	if loads != 4 {
+		t.Fatalf("negative entry should expire, got %d loads", loads)
+	}
+
+	gee.Set("unknown", []byte("now"))
+	if v, err := gee.Get("unknown"); err != nil || v.String() != "now" {
+		t.Fatalf("Set should clear the negative entry, got %v", err)
+	}
+}
+
+func TestNegativeCacheFromPeer(t *testing.T) {
+	peer := &fakePeer{}
+	gee := NewGroup("negative-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("not-found from the owner should not fall back to the local getter")
+			return nil, nil
+		}), WithNegativeTTL(time.Minute))
+	gee.RegisterPeers(peer)
+
+	for i := 0; i < 2; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("not-found from peer should be cached, got %d gets", peer.gets)
+	}
+	if _, errs := gee.GetMany([]string{"unknown", "missing"}); !errors.Is(errs[0], ErrNotFound) || !errors.Is(errs[1], ErrNotFound) {
+		t.Fatalf("expected not found from batch, got %v", errs)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"name":"Tom","score":630}`, 100)
+	for _, enc := range []Encoding{Gzip, Zstd, Snappy} {
+		gee := NewGroup(fmt.Sprintf("compress-%d", enc), 2<<20, GetterFunc(
+			func(key string) ([]byte, error) {
+				if key == "large" {
+					return []byte(large), nil
+				}
+				return []byte(key), nil
+			}), WithCompression(enc, 64))
+		gee.Get("large")
+		gee.Get("small")
+
+		if v, err := gee.Get("large"); err != nil || v.String() != large || string(v.ByteSlice()) != large {
+			t.Fatalf("encoding %d: large value mismatch: %v", enc, err)
+		}
+		if v, _ := gee.Get("small"); v.enc != Identity || v.String() != "small" {
+			t.Fatalf("encoding %d: values below minSize should not be compressed", enc)
+		}
+		if s := gee.CacheStats(MainCache); s.Bytes >= int64(len(large)) {
+			t.Fatalf("encoding %d: cache should account for compressed size, got %d bytes", enc, s.Bytes)
+		}
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	bomb := make([]byte, 4<<10)
+	for _, enc := range []Encoding{Gzip, Zstd, Snappy} {
+		b, _ := codecs[enc].encode(bomb)
+		if _, err := peerValue(b, pb.Encoding(enc), time.Time{}, 1<<10); !errors.Is(err, errValueTooLarge) {
+			t.Fatalf("encoding %d: oversized peer value should be rejected, got %v", enc, err)
+		}
+		// 本节点压缩的 value 不受 peer 的上限限制
+		if out, err := (BytesView{b: b, enc: enc}).Bytes(); err != nil || len(out) != len(bomb) {
+			t.Fatalf("encoding %d: local value should decode fully, got %d bytes, %v", enc, len(out), err)
+		}
+		// 截断的数据在进入缓存前就被拒绝
+		if _, err := peerValue(b[:len(b)/2], pb.Encoding(enc), time.Time{}, 0); err == nil {
+			t.Fatalf("encoding %d: truncated peer value should be rejected", enc)
+		}
+	}
+	if _, err := peerValue([]byte("not gzip"), pb.Encoding_GZIP, time.Time{}, 0); err == nil {
+		t.Fatal("malformed peer value should be rejected")
+	}
+	if _, err := (BytesView{b: []byte("not zstd"), enc: Zstd}).Bytes(); err == nil {
+		t.Fatal("decoding errors should reach the caller")
+	}
+}
+
+// corruptPeer 返回以 gzip 编码但已损坏的 value
+type corruptPeer struct{ value []byte }
+
+func (p corruptPeer) PickPeer(key string) (PeerGetter, bool) { return p, true }
+
+func (p corruptPeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value, out.Encoding = p.value, pb.Encoding_GZIP
+	return nil
+}
+
+func TestCorruptPeerValue(t *testing.T) {
+	good, _ := codecs[Gzip].encode([]byte("630"))
+	peer := corruptPeer{value: good[:len(good)-4]}
+	g := newGroup("corrupt-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}), WithPeerPicker(peer))
+	if v, err := g.Get("Tom"); err != nil || v.String() != "local" {
+		t.Fatalf("corrupt peer value should fall back to the getter, got %q, %v", v.String(), err)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	release := make(chan struct{})
+	gee := NewGroup("stale", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			v := version.Add(1)
+			if v > 1 {
+				<-release
+			}
+			return []byte(fmt.Sprintf("v%d", v)), nil
+		}), WithTTL(20*time.Millisecond), WithStaleWhileRevalidate(time.Minute))
+
+	gee.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	// 刷新被阻塞时仍立即返回旧值
+	for i := 0; i < 3; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "v1" {
+			t.Fatalf("expected stale v1, got %q %v", v.String(), err)
+		}
+	}
+	close(release)
+	waitFor(t, func() bool {
+		v, _ := gee.Get("Tom")
+		return v.String() == "v2"
+	})
+	if s := gee.Stats(); s.StaleHits < 3 || s.Refreshes != 1 || version.Load() != 2 {
+		t.Fatalf("expected a single background refresh, got %+v after %d loads", s, version.Load())
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads atomic.Int32
+	gee := NewGroup("refresh-ahead", 2<<10, TTLGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			loads.Add(1)
+			return []byte(key), 100 * time.Millisecond, nil
+		}), WithRefreshAhead(0.5))
+
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if loads.Load() != 1 {
+		t.Fatalf("fresh entry should not be refreshed, got %d loads", loads.Load())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("refresh-ahead should still serve the cached value, got %v", err)
+	}
+	waitFor(t, func() bool { return loads.Load() == 2 })
+	waitFor(t, func() bool {
+		v, _ := gee.lookupCache("Tom")
+		return time.Until(v.Expire()) > 50*time.Millisecond
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type score struct {
+	Name  string
+	Score int
+}
+
+func TestTypedGroupCodecs(t *testing.T) {
+	codecs := map[string]Codec[score]{
+		"json":    JSONCodec[score]{},
+		"gob":     GobCodec[score]{},
+		"msgpack": MsgpackCodec[score]{},
+	}
+	for name, codec := range codecs {
+		g := NewTypedGroup("typed-"+name, 2<<10, codec, func(ctx context.Context, key string) (score, error) {
+			return score{Name: key, Score: len(key)}, nil
+		})
+		if v, err := g.Get("Tom"); err != nil || v != (score{"Tom", 3}) {
+			t.Fatalf("%s: Get = %+v, %v", name, v, err)
+		}
+	}
+
+	g := NewTypedGroup("typed-proto", 2<<10, ProtoCodec[*pb.Request]{}, func(ctx context.Context, key string) (*pb.Request, error) {
+		return &pb.Request{Group: "scores", Key: key}, nil
+	})
+	if v, err := g.Get("Tom"); err != nil || v.GetKey() != "Tom" || v.GetGroup() != "scores" {
+		t.Fatalf("proto: Get = %v, %v", v, err)
+	}
+}
+
+func TestTypedGroupObjectCache(t *testing.T) {
+	var decodes atomic.Int32
+	codec := countingCodec{JSONCodec[*score]{}, &decodes}
+	g := NewTypedGroup("typed-objects", 2<<10, Codec[*score](codec), func(ctx context.Context, key string) (*score, error) {
+		if _, ok := db[key]; !ok {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return &score{Name: key}, nil
+	}, WithObjectCache(1))
+
+	first, err := g.Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := g.Get("Tom"); again != first || decodes.Load() != 1 {
+		t.Fatalf("expected the decoded object to be reused, decodes = %d", decodes.Load())
+	}
+
+	// 值被替换后不能再返回旧对象
+	if err := g.Set("Tom", &score{Name: "Tom", Score: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := g.Get("Tom"); v.Score != 1 || decodes.Load() != 2 {
+		t.Fatalf("Get after Set = %+v, decodes = %d", v, decodes.Load())
+	}
+
+	// 超过容量时淘汰最久未使用的对象
+	g.Get("Jack")
+	g.Get("Tom")
+	if decodes.Load() != 4 {
+		t.Fatalf("decodes = %d, want 4", decodes.Load())
+	}
+
+	if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// jsonPeer 每次都返回新编码的 score，模拟从 peer 获取的 value
+type jsonPeer struct{}
+
+func (p jsonPeer) PickPeer(key string) (PeerGetter, bool) { return p, true }
+
+func (p jsonPeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value = []byte(`{"Name":"` + in.GetKey() + `"}`)
+	return nil
+}
+
+func TestTypedGroupObjectCachePeer(t *testing.T) {
+	defer func(odds int) { hotCacheOdds = odds }(hotCacheOdds)
+	hotCacheOdds = math.MaxInt32
+
+	var decodes atomic.Int32
+	codec := countingCodec{JSONCodec[*score]{}, &decodes}
+	getter := func(ctx context.Context, key string) (*score, error) {
+		t.Fatalf("key %s should be loaded from the peer", key)
+		return nil, nil
+	}
+	r := NewRegistry()
+	g, _ := NewTypedGroupIn(r, "typed-peer", 2<<10, Codec[*score](codec), getter,
+		WithObjectCache(10), WithGroupOptions(WithPeerPicker(jsonPeer{})))
+	first, _ := g.Get("Tom")
+	if again, _ := g.Get("Tom"); again != first || decodes.Load() != 1 {
+		t.Fatalf("objects of peer-owned keys should be reused, decodes = %d", decodes.Load())
+	}
+
+	// 对象缓存最多占用 Group 字节上限的 1/objectCacheFraction
+	small, _ := NewTypedGroupIn(r, "typed-peer-small", 64, Codec[*score](codec), getter,
+		WithObjectCache(10), WithGroupOptions(WithPeerPicker(jsonPeer{})))
+	small.Get("Tom")
+	if n := small.objects.Len(); n != 0 {
+		t.Fatalf("object larger than the byte limit should not be cached, got %d items", n)
+	}
+}
+
+func TestNewTypedGroupIn(t *testing.T) {
+	r := NewRegistry()
+	getter := func(ctx context.Context, key string) (score, error) {
+		return score{Name: key}, nil
+	}
+	g, err := NewTypedGroupIn(r, "typed-registry", 2<<10, Codec[score](JSONCodec[score]{}), getter,
+		WithObjectCache(1), WithGroupOptions(WithTTL(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Get("typed-registry") != g.Group() || GetGroup("typed-registry") != nil {
+		t.Fatal("typed group should only be registered in r")
+	}
+	if g.Group().ttl != time.Minute || g.maxObjs != 1 {
+		t.Fatalf("options not applied: ttl = %v, maxObjs = %d", g.Group().ttl, g.maxObjs)
+	}
+	if _, err := NewTypedGroupIn(r, "typed-registry", 2<<10, Codec[score](JSONCodec[score]{}), getter); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("expected ErrGroupExists, got %v", err)
+	}
+}
+
+type countingCodec struct {
+	JSONCodec[*score]
+	decodes *atomic.Int32
+}
+
+func (c countingCodec) Unmarshal(b []byte) (*score, error) {
+	c.decodes.Add(1)
+	return c.JSONCodec.Unmarshal(b)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("v", 100)), nil
+	})
+	g, err := r.NewGroup("b", 1<<10, getter, WithTTL(time.Minute), WithPolicy(LFU))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.NewGroup("b", 1<<10, getter); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("expected ErrGroupExists, got %v", err)
+	}
+	if _, err := r.NewGroup("a", 1<<10, getter); err != nil {
+		t.Fatal(err)
+	}
+	if GetGroup("b") != nil {
+		t.Fatal("groups of a custom registry should not be visible in the default registry")
+	}
+	var names []string
+	for _, g := range r.List() {
+		names = append(names, g.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("List = %v", names)
+	}
+
+	for i := 0; i < 8; i++ {
+		g.Get(fmt.Sprint(i))
+	}
+	g.SetCacheBytes(256)
+	if s := g.mainCache.stats(); g.CacheBytes() != 256 || s.MaxBytes != 224 || s.Bytes > 224 {
+		t.Fatalf("after resize: CacheBytes = %d, mainCache = %+v", g.CacheBytes(), s)
+	}
+
+	if !r.Remove("b") || r.Remove("b") || r.Get("b") != nil {
+		t.Fatal("Remove should unregister the group exactly once")
+	}
+	select {
+	case <-g.mainCache.done:
+	default:
+		t.Fatal("removed group should stop its janitor")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	var heap atomic.Uint64
+	b := NewBudget(8000, WithHeapLimit(1000))
+	b.readHeap = heap.Load
+	r := NewRegistry()
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	})
+	hot, _ := r.NewGroup("budget-hot", 0, getter, WithBudget(b))
+	cold, _ := r.NewGroup("budget-cold", 0, getter, WithBudget(b))
+	small, _ := r.NewGroup("budget-small", 1000, getter, WithBudget(b))
+	total := func() int64 { return hot.CacheBytes() + cold.CacheBytes() + small.CacheBytes() }
+	if small.CacheBytes() != 1000 || total() > 8000 {
+		t.Fatalf("initial shares: hot %d, cold %d, small %d", hot.CacheBytes(), cold.CacheBytes(), small.CacheBytes())
+	}
+
+	for i := 0; i < 100; i++ {
+		hot.Get("Tom")
+	}
+	b.Rebalance()
+	if hot.CacheBytes() <= cold.CacheBytes() || cold.CacheBytes() < 8000/budgetReserveFraction/3 || total() > 8000 {
+		t.Fatalf("after hits: hot %d, cold %d, small %d", hot.CacheBytes(), cold.CacheBytes(), small.CacheBytes())
+	}
+
+	// 堆内存接近上限时收缩，压力解除后逐步恢复
+	heap.Store(950)
+	b.Rebalance()
+	if s := b.Stats(); s.Bytes != 6000 || total() > 6000 {
+		t.Fatalf("under pressure: budget %d, total %d", s.Bytes, total())
+	}
+	heap.Store(100)
+	b.Rebalance()
+	if s := b.Stats(); s.Bytes != 8000 {
+		t.Fatalf("after pressure: budget %d", s.Bytes)
+	}
+
+	// 手动设置的字节数作为上限保留，不会被下一次分配覆盖
+	small.SetCacheBytes(500)
+	b.Rebalance()
+	if small.CacheBytes() != 500 || total() > 8000 {
+		t.Fatalf("after SetCacheBytes: hot %d, cold %d, small %d", hot.CacheBytes(), cold.CacheBytes(), small.CacheBytes())
+	}
+
+	r.Remove("budget-hot")
+	if b.Stats().Groups != 2 || cold.CacheBytes()+small.CacheBytes() > 8000 || cold.CacheBytes() < 6000 {
+		t.Fatalf("after remove: cold %d, small %d", cold.CacheBytes(), small.CacheBytes())
+	}
+}
+
+func TestSplitSmallBytes(t *testing.T) {
+	g := &Group{negativeTTL: time.Second}
+	for _, n := range []int64{1, 2, 15} {
+		mainBytes, _, negBytes := g.splitBytes(n)
+		if mainBytes < 1 || negBytes < 1 {
+			t.Fatalf("splitBytes(%d) = main %d, negative %d; 0 would mean unlimited", n, mainBytes, negBytes)
+		}
+	}
+	if mainBytes, hotBytes, negBytes := g.splitBytes(0); mainBytes != 0 || hotBytes != 0 || negBytes != 0 {
+		t.Fatalf("splitBytes(0) should stay unlimited")
+	}
+}
@@ -21,12 +21,112 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Encoding 是 value 的压缩方式
+type Encoding int32
+
+const (
+	Encoding_IDENTITY Encoding = 0
+	Encoding_GZIP     Encoding = 1
+	Encoding_ZSTD     Encoding = 2
+	Encoding_SNAPPY   Encoding = 3
+)
+
+// Enum value maps for Encoding.
+var (
+	Encoding_name = map[int32]string{
+		0: "IDENTITY",
+		1: "GZIP",
+		2: "ZSTD",
+		3: "SNAPPY",
+	}
+	Encoding_value = map[string]int32{
+		"IDENTITY": 0,
+		"GZIP":     1,
+		"ZSTD":     2,
+		"SNAPPY":   3,
+	}
+)
+
+func (x Encoding) Enum() *Encoding {
+	p := new(Encoding)
+	*p = x
+	return p
+}
+
+func (x Encoding) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Encoding) Descriptor() protoreflect.EnumDescriptor {
+	return file_geecachepb_proto_enumTypes[0].Descriptor()
+}
+
+func (Encoding) Type() protoreflect.EnumType {
+	return &file_geecachepb_proto_enumTypes[0]
+}
+
+func (x Encoding) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Encoding.Descriptor instead.
+func (Encoding) EnumDescriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{0}
+}
+
+type Status int32
+
+const (
+	Status_OK        Status = 0
+	Status_NOT_FOUND Status = 1 // key 在数据源中不存在，error 为 Getter 返回的错误信息
+)
+
+// Enum value maps for Status.
+var (
+	Status_name = map[int32]string{
+		0: "OK",
+		1: "NOT_FOUND",
+	}
+	Status_value = map[string]int32{
+		"OK":        0,
+		"NOT_FOUND": 1,
+	}
+)
+
+func (x Status) Enum() *Status {
+	p := new(Status)
+	*p = x
+	return p
+}
+
+func (x Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_geecachepb_proto_enumTypes[1].Descriptor()
+}
+
+func (Status) Type() protoreflect.EnumType {
+	return &file_geecachepb_proto_enumTypes[1]
+}
+
+func (x Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Status.Descriptor instead.
+func (Status) EnumDescriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{1}
+}
+
 type Request struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
-	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Group          string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key            string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	AcceptEncoding []Encoding             `protobuf:"varint,3,rep,packed,name=accept_encoding,json=acceptEncoding,proto3,enum=geecachepb.Encoding" json:"accept_encoding,omitempty"` // 调用方能够解压的编码，为空时只接受 IDENTITY
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *Request) Reset() {
@@ -73,9 +173,20 @@ func (x *Request) GetKey() string {
 	return ""
 }
 
+func (x *Request) GetAcceptEncoding() []Encoding {
+	if x != nil {
+		return x.AcceptEncoding
+	}
+	return nil
+}
+
 type Response struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Expire        int64                  `protobuf:"varint,2,opt,name=expire,proto3" json:"expire,omitempty"` // 过期时间，UnixNano，0 表示永不过期
+	Status        Status                 `protobuf:"varint,3,opt,name=status,proto3,enum=geecachepb.Status" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Encoding      Encoding               `protobuf:"varint,5,opt,name=encoding,proto3,enum=geecachepb.Encoding" json:"encoding,omitempty"` // value 的编码，必须是 accept_encoding 之一
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -117,20 +228,379 @@ func (x *Response) GetValue() []byte {
 	return nil
 }
 
+func (x *Response) GetExpire() int64 {
+	if x != nil {
+		return x.Expire
+	}
+	return 0
+}
+
+func (x *Response) GetStatus() Status {
+	if x != nil {
+		return x.Status
+	}
+	return Status_OK
+}
+
+func (x *Response) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Response) GetEncoding() Encoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return Encoding_IDENTITY
+}
+
+type SetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Expire        int64                  `protobuf:"varint,4,opt,name=expire,proto3" json:"expire,omitempty"` // 过期时间，UnixNano，0 表示永不过期
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_geecachepb_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *SetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SetRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *SetRequest) GetExpire() int64 {
+	if x != nil {
+		return x.Expire
+	}
+	return 0
+}
+
+type Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_geecachepb_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{3}
+}
+
+type BatchRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Group          string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys           []string               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	AcceptEncoding []Encoding             `protobuf:"varint,3,rep,packed,name=accept_encoding,json=acceptEncoding,proto3,enum=geecachepb.Encoding" json:"accept_encoding,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_geecachepb_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *BatchRequest) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetAcceptEncoding() []Encoding {
+	if x != nil {
+		return x.AcceptEncoding
+	}
+	return nil
+}
+
+type BatchItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Expire        int64                  `protobuf:"varint,3,opt,name=expire,proto3" json:"expire,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"` // 不为空时表示该 key 加载失败
+	Status        Status                 `protobuf:"varint,5,opt,name=status,proto3,enum=geecachepb.Status" json:"status,omitempty"`
+	Encoding      Encoding               `protobuf:"varint,6,opt,name=encoding,proto3,enum=geecachepb.Encoding" json:"encoding,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_geecachepb_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchItem) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *BatchItem) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *BatchItem) GetExpire() int64 {
+	if x != nil {
+		return x.Expire
+	}
+	return 0
+}
+
+func (x *BatchItem) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BatchItem) GetStatus() Status {
+	if x != nil {
+		return x.Status
+	}
+	return Status_OK
+}
+
+func (x *BatchItem) GetEncoding() Encoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return Encoding_IDENTITY
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*BatchItem           `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"` // 与 BatchRequest.keys 一一对应
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_geecachepb_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geecachepb_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_geecachepb_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchResponse) GetItems() []*BatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
 var File_geecachepb_proto protoreflect.FileDescriptor
 
 const file_geecachepb_proto_rawDesc = "" +
 	"\n" +
 	"\x10geecachepb.proto\x12\n" +
-	"geecachepb\"1\n" +
+	"geecachepb\"p\n" +
 	"\aRequest\x12\x14\n" +
 	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
-	"\x03key\x18\x02 \x01(\tR\x03key\" \n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12=\n" +
+	"\x0faccept_encoding\x18\x03 \x03(\x0e2\x14.geecachepb.EncodingR\x0eacceptEncoding\"\xac\x01\n" +
 	"\bResponse\x12\x14\n" +
-	"\x05value\x18\x01 \x01(\fR\x05value2>\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x12\x16\n" +
+	"\x06expire\x18\x02 \x01(\x03R\x06expire\x12*\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x12.geecachepb.StatusR\x06status\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x120\n" +
+	"\bencoding\x18\x05 \x01(\x0e2\x14.geecachepb.EncodingR\bencoding\"b\n" +
+	"\n" +
+	"SetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\x12\x16\n" +
+	"\x06expire\x18\x04 \x01(\x03R\x06expire\"\x05\n" +
+	"\x03Ack\"w\n" +
+	"\fBatchRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\tR\x04keys\x12=\n" +
+	"\x0faccept_encoding\x18\x03 \x03(\x0e2\x14.geecachepb.EncodingR\x0eacceptEncoding\"\xbf\x01\n" +
+	"\tBatchItem\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\x12\x16\n" +
+	"\x06expire\x18\x03 \x01(\x03R\x06expire\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12*\n" +
+	"\x06status\x18\x05 \x01(\x0e2\x12.geecachepb.StatusR\x06status\x120\n" +
+	"\bencoding\x18\x06 \x01(\x0e2\x14.geecachepb.EncodingR\bencoding\"<\n" +
+	"\rBatchResponse\x12+\n" +
+	"\x05items\x18\x01 \x03(\v2\x15.geecachepb.BatchItemR\x05items*8\n" +
+	"\bEncoding\x12\f\n" +
+	"\bIDENTITY\x10\x00\x12\b\n" +
+	"\x04GZIP\x10\x01\x12\b\n" +
+	"\x04ZSTD\x10\x02\x12\n" +
+	"\n" +
+	"\x06SNAPPY\x10\x03*\x1f\n" +
+	"\x06Status\x12\x06\n" +
+	"\x02OK\x10\x00\x12\r\n" +
+	"\tNOT_FOUND\x10\x012\x92\x02\n" +
 	"\n" +
 	"GroupCache\x120\n" +
-	"\x03Get\x12\x13.geecachepb.Request\x1a\x14.geecachepb.ResponseB+Z)github.com/zsm/demo11/geecache/geecachepbb\x06proto3"
+	"\x03Get\x12\x13.geecachepb.Request\x1a\x14.geecachepb.Response\x12>\n" +
+	"\aGetMany\x12\x18.geecachepb.BatchRequest\x1a\x19.geecachepb.BatchResponse\x12.\n" +
+	"\x03Set\x12\x16.geecachepb.SetRequest\x1a\x0f.geecachepb.Ack\x12.\n" +
+	"\x06Remove\x12\x13.geecachepb.Request\x1a\x0f.geecachepb.Ack\x122\n" +
+	"\n" +
+	"Invalidate\x12\x13.geecachepb.Request\x1a\x0f.geecachepb.AckB+Z)github.com/zsm/demo11/geecache/geecachepbb\x06proto3"
 
 var (
 	file_geecachepb_proto_rawDescOnce sync.Once
@@ -144,19 +614,42 @@ func file_geecachepb_proto_rawDescGZIP() []byte {
 	return file_geecachepb_proto_rawDescData
 }
 
-var file_geecachepb_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_geecachepb_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_geecachepb_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_geecachepb_proto_goTypes = []any{
-	(*Request)(nil),  // 0: geecachepb.Request
-	(*Response)(nil), // 1: geecachepb.Response
+	(Encoding)(0),         // 0: geecachepb.Encoding
+	(Status)(0),           // 1: geecachepb.Status
+	(*Request)(nil),       // 2: geecachepb.Request
+	(*Response)(nil),      // 3: geecachepb.Response
+	(*SetRequest)(nil),    // 4: geecachepb.SetRequest
+	(*Ack)(nil),           // 5: geecachepb.Ack
+	(*BatchRequest)(nil),  // 6: geecachepb.BatchRequest
+	(*BatchItem)(nil),     // 7: geecachepb.BatchItem
+	(*BatchResponse)(nil), // 8: geecachepb.BatchResponse
 }
 var file_geecachepb_proto_depIdxs = []int32{
-	0, // 0: geecachepb.GroupCache.Get:input_type -> geecachepb.Request
-	1, // 1: geecachepb.GroupCache.Get:output_type -> geecachepb.Response
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: geecachepb.Request.accept_encoding:type_name -> geecachepb.Encoding
+	1,  // 1: geecachepb.Response.status:type_name -> geecachepb.Status
+	0,  // 2: geecachepb.Response.encoding:type_name -> geecachepb.Encoding
+	0,  // 3: geecachepb.BatchRequest.accept_encoding:type_name -> geecachepb.Encoding
+	1,  // 4: geecachepb.BatchItem.status:type_name -> geecachepb.Status
+	0,  // 5: geecachepb.BatchItem.encoding:type_name -> geecachepb.Encoding
+	7,  // 6: geecachepb.BatchResponse.items:type_name -> geecachepb.BatchItem
+	2,  // 7: geecachepb.GroupCache.Get:input_type -> geecachepb.Request
+	6,  // 8: geecachepb.GroupCache.GetMany:input_type -> geecachepb.BatchRequest
+	4,  // 9: geecachepb.GroupCache.Set:input_type -> geecachepb.SetRequest
+	2,  // 10: geecachepb.GroupCache.Remove:input_type -> geecachepb.Request
+	2,  // 11: geecachepb.GroupCache.Invalidate:input_type -> geecachepb.Request
+	3,  // 12: geecachepb.GroupCache.Get:output_type -> geecachepb.Response
+	8,  // 13: geecachepb.GroupCache.GetMany:output_type -> geecachepb.BatchResponse
+	5,  // 14: geecachepb.GroupCache.Set:output_type -> geecachepb.Ack
+	5,  // 15: geecachepb.GroupCache.Remove:output_type -> geecachepb.Ack
+	5,  // 16: geecachepb.GroupCache.Invalidate:output_type -> geecachepb.Ack
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_geecachepb_proto_init() }
@@ -169,13 +662,14 @@ func file_geecachepb_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_geecachepb_proto_rawDesc), len(file_geecachepb_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_geecachepb_proto_goTypes,
 		DependencyIndexes: file_geecachepb_proto_depIdxs,
+		EnumInfos:         file_geecachepb_proto_enumTypes,
 		MessageInfos:      file_geecachepb_proto_msgTypes,
 	}.Build()
 	File_geecachepb_proto = out.File
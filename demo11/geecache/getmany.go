@@ -0,0 +1,322 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+)
+
+// BatchGetter 是 Getter 的可选扩展，一次从数据源加载多个 key，
+// 返回的 values 和 errs 与 keys 一一对应
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) (values [][]byte, errs []error)
+}
+
+type BatchGetterFunc func(ctx context.Context, keys []string) ([][]byte, []error)
+
+func (f BatchGetterFunc) Get(key string) ([]byte, error) {
+	return f.GetContext(context.Background(), key)
+}
+
+func (f BatchGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	values, errs := f(ctx, []string{key})
+	if err := checkBatch(1, values, errs); err != nil {
+		return nil, err
+	}
+	return values[0], errs[0]
+}
+
+func (f BatchGetterFunc) GetMany(ctx context.Context, keys []string) ([][]byte, []error) {
+	return f(ctx, keys)
+}
+
+func (g *Group) GetMany(keys []string) ([]BytesView, []error) {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext 批量获取多个 key，返回的 values 和 errs 与 keys 一一对应。
+// 未命中缓存的 key 按所属 peer 分组，每个 peer 只发送一次批量请求。请求失败或 peer 对单个 key 返回错误时，
+// 只将尚未获取到的 key 依次改发给其他所有者，与 Get 相同，
+// 归本节点所有或所有 peer 都失败的 key 通过 BatchGetter（若实现）一次加载。
+// 与其他 Get 同时加载的 key 会等待正在进行的加载，不会重复加载
+func (g *Group) GetManyContext(ctx context.Context, keys []string) ([]BytesView, []error) {
+	values := make([]BytesView, len(keys))
+	errs := make([]error, len(keys))
+	g.stats.gets.Add(int64(len(keys)))
+
+	// 同一个 key 可能出现多次，只加载一次
+	positions := make(map[string][]int)
+	var missing []string
+	for i, key := range keys {
+		if key == "" {
+			errs[i] = fmt.Errorf("key is required")
+			continue
+		}
+		if v, ok := g.lookupCache(key); ok {
+			g.stats.cacheHits.Add(1)
+			if g.needsRefresh(v) {
+				g.refreshAsync(key)
+			}
+			values[i] = v
+			continue
+		}
+		if err := g.lookupNegative(key); err != nil {
+			g.stats.cacheHits.Add(1)
+			errs[i] = err
+			continue
+		}
+		if _, ok := positions[key]; !ok {
+			missing = append(missing, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+	if len(missing) == 0 {
+		return values, errs
+	}
+	g.stats.loads.Add(int64(len(missing)))
+
+	var mu sync.Mutex
+	loaded := make(map[string]bool, len(missing))
+	set := func(key string, value BytesView, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loaded[key] = true
+		for _, i := range positions[key] {
+			values[i], errs[i] = value, err
+		}
+	}
+
+	// 先在 singleflight 中登记要加载的 key，已经在加载的 key 等待那次加载的结果
+	var wg sync.WaitGroup
+	claimed := make(map[string]func(interface{}, error), len(missing))
+	for _, key := range missing {
+		complete, ok := g.loader.Claim(key)
+		if ok {
+			claimed[key] = complete
+			continue
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			viewi, err, _ := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+				g.stats.loadsDeduped.Add(1)
+				return g.loadFromOwners(ctx, key)
+			})
+			if err != nil {
+				set(key, BytesView{}, err)
+				return
+			}
+			set(key, viewi.(BytesView), nil)
+		}(key)
+	}
+	defer wg.Wait()
+	defer func() {
+		// 出现 panic 时也要结束登记，避免等待这些 key 的调用方永远阻塞
+		mu.Lock()
+		defer mu.Unlock()
+		for key, complete := range claimed {
+			i := positions[key][0]
+			switch {
+			case !loaded[key]:
+				complete(nil, errors.New("batch load did not complete"))
+			case errs[i] != nil:
+				complete(nil, errs[i])
+			default:
+				complete(values[i], nil)
+			}
+		}
+	}()
+	g.stats.loadsDeduped.Add(int64(len(claimed)))
+
+	ownersOf := make(map[string][]PeerGetter)
+	byPeer := make(map[PeerGetter][]string)
+	var local []string
+	for key := range claimed {
+		if owners := g.pickOwners(ctx, key); len(owners) > 0 {
+			ownersOf[key] = owners
+			byPeer[owners[0]] = append(byPeer[owners[0]], key)
+		} else {
+			local = append(local, key)
+		}
+	}
+
+	for len(byPeer) > 0 && ctx.Err() == nil {
+		var failed []string
+		var pwg sync.WaitGroup
+		for peer, peerKeys := range byPeer {
+			pwg.Add(1)
+			go func(peer PeerGetter, peerKeys []string) {
+				defer pwg.Done()
+				rest, err := g.getManyFromPeer(ctx, peer, peerKeys, set)
+				if len(rest) == 0 {
+					return
+				}
+				g.stats.peerErrors.Add(int64(len(rest)))
+				log.Println("[GeeCache] Failed to get batch from peer", err)
+				mu.Lock()
+				failed = append(failed, rest...)
+				mu.Unlock()
+			}(peer, peerKeys)
+		}
+		pwg.Wait()
+
+		// 未获取到的 key 改发给下一个所有者，没有其他所有者时在本地加载
+		byPeer = make(map[PeerGetter][]string)
+		for _, key := range failed {
+			owners := ownersOf[key][1:]
+			ownersOf[key] = owners
+			if len(owners) > 0 {
+				byPeer[owners[0]] = append(byPeer[owners[0]], key)
+			} else {
+				local = append(local, key)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		for _, keys := range byPeer {
+			local = append(local, keys...)
+		}
+		for _, key := range local {
+			set(key, BytesView{}, err)
+		}
+		return values, errs
+	}
+	g.getManyLocally(ctx, local, set)
+	return values, errs
+}
+
+// getManyFromPeer 从 peer 获取 keys，获取到的 key 通过 set 返回，
+// 未获取到的 key 作为 rest 返回，err 说明其中一个 key 失败的原因
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string, set func(string, BytesView, error)) (rest []string, err error) {
+	bg, ok := peer.(BatchPeerGetter)
+	if !ok {
+		return g.getEachFromPeer(ctx, peer, keys, set)
+	}
+	req := &pb.BatchRequest{Group: g.name, Keys: keys, AcceptEncoding: acceptEncodings}
+	res := &pb.BatchResponse{}
+	if err := bg.GetMany(ctx, req, res); err != nil {
+		return keys, err
+	}
+	if len(res.Items) != len(keys) {
+		return keys, fmt.Errorf("peer returned %d items for %d keys", len(res.Items), len(keys))
+	}
+	for i, item := range res.Items {
+		if item.Status == pb.Status_NOT_FOUND {
+			g.stats.peerLoads.Add(1)
+			err := &notFoundError{msg: item.Error}
+			g.cacheNegative(keys[i], err)
+			set(keys[i], BytesView{}, err)
+			continue
+		}
+		if item.Error != "" {
+			rest, err = append(rest, keys[i]), fmt.Errorf("%s: %s", keys[i], item.Error)
+			continue
+		}
+		e := expireTime(item.Expire)
+		if item.Expire == 0 {
+			e = g.expireAt(0)
+		}
+		value, verr := peerValue(item.Value, item.Encoding, e, valueLimit(peer))
+		if verr != nil {
+			rest, err = append(rest, keys[i]), fmt.Errorf("%s: %w", keys[i], verr)
+			continue
+		}
+		g.stats.peerLoads.Add(1)
+		if g.hotCache.capacity() > 0 && rand.Intn(hotCacheOdds) == 0 {
+			g.hotCache.add(keys[i], value)
+		}
+		set(keys[i], value, nil)
+	}
+	return rest, err
+}
+
+// getEachFromPeer 用于不支持 BatchPeerGetter 的 peer，逐个发送请求。
+// 遇到第一个失败的请求时停止，该 key 及之后尚未请求的 key 作为 rest 返回，之前获取到的 key 已通过 set 返回
+func (g *Group) getEachFromPeer(ctx context.Context, peer PeerGetter, keys []string, set func(string, BytesView, error)) ([]string, error) {
+	for i, key := range keys {
+		value, err := g.getFromPeer(ctx, peer, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return keys[i:], err
+		}
+		g.stats.peerLoads.Add(1)
+		if err != nil {
+			g.cacheNegative(key, err)
+		} else if g.hotCache.capacity() > 0 && rand.Intn(hotCacheOdds) == 0 {
+			g.hotCache.add(key, value)
+		}
+		set(key, value, err)
+	}
+	return nil, nil
+}
+
+// getManyLocally 通过 Getter 加载 keys，Getter 实现了 BatchGetter 时只调用一次，
+// keys 需已由调用方在 singleflight 中登记
+func (g *Group) getManyLocally(ctx context.Context, keys []string, set func(string, BytesView, error)) {
+	if len(keys) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, key := range keys {
+			value, err := g.getLocally(ctx, key)
+			set(key, value, err)
+		}
+		return
+	}
+
+	bytes, errs := bg.GetMany(ctx, keys)
+	if err := checkBatch(len(keys), bytes, errs); err != nil {
+		g.stats.localLoadErrs.Add(int64(len(keys)))
+		for _, key := range keys {
+			set(key, BytesView{}, err)
+		}
+		return
+	}
+	for i, key := range keys {
+		if errs[i] != nil {
+			g.stats.localLoadErrs.Add(1)
+			g.cacheNegative(key, errs[i])
+			set(key, BytesView{}, errs[i])
+			continue
+		}
+		g.stats.localLoads.Add(1)
+		value := g.compress(BytesView{b: cloneBytes(bytes[i]), e: g.expireAt(0)})
+		g.populateCache(key, value)
+		set(key, value, nil)
+	}
+}
+
+// batchResponse 将 GetManyContext 的结果转换为 pb.BatchResponse，value 按 accept 编码
+func batchResponse(keys []string, values []BytesView, errs []error, accept []pb.Encoding) *pb.BatchResponse {
+	res := &pb.BatchResponse{Items: make([]*pb.BatchItem, len(keys))}
+	for i, key := range keys {
+		item := &pb.BatchItem{Key: key}
+		if errs[i] != nil {
+			item.Error = errs[i].Error()
+			if errors.Is(errs[i], ErrNotFound) {
+				item.Status = pb.Status_NOT_FOUND
+			}
+		} else if value, enc, err := wireValue(values[i], accept); err != nil {
+			item.Error = err.Error()
+		} else {
+			item.Value, item.Encoding = value, enc
+			item.Expire = expireNano(values[i].e)
+		}
+		res.Items[i] = item
+	}
+	return res
+}
+
+// checkBatch 检查 BatchGetter 返回的结果是否与 keys 一一对应
+func checkBatch(n int, values [][]byte, errs []error) error {
+	if len(values) != n || len(errs) != n {
+		return fmt.Errorf("BatchGetter returned %d values and %d errors for %d keys", len(values), len(errs), n)
+	}
+	return nil
+}
@@ -2,4 +2,18 @@ module github.com/zsm/demo11/geecache
 
 go 1.24.3
 
-require google.golang.org/protobuf v1.36.7
+require (
+	github.com/golang/snappy v1.0.0
+	github.com/klauspost/compress v1.18.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/grpc v1.74.2
+	google.golang.org/protobuf v1.36.7
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250528174236-200df99c418a // indirect
+)
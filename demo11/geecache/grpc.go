@@ -0,0 +1,325 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zsm/demo11/geecache/consistenthash"
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultGRPCTimeout = 3 * time.Second
+
+// GRPCPool 与 HTTPPool 类似，但节点之间通过 gRPC 通信，
+// 每个 peer 复用同一个 HTTP/2 连接，并为每次请求设置超时
+type GRPCPool struct {
+	self        string
+	timeout     time.Duration
+	dialOpts    []grpc.DialOption
+	registry    *Registry
+	mu          sync.Mutex
+	peers       *consistenthash.Map
+	grpcGetters map[string]*grpcGetter
+	server      *grpc.Server // 由 Serve 创建，供 GracefulStop 停止
+	stopped     bool         // GracefulStop 已被调用，之后的 Serve 直接返回
+}
+
+type GRPCPoolOption func(*GRPCPool)
+
+// WithGRPCTimeout 设置访问 peer 时单次请求的超时时间
+func WithGRPCTimeout(timeout time.Duration) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.timeout = timeout
+	}
+}
+
+// WithDialOptions 设置连接 peer 时使用的 grpc.DialOption，默认不使用 TLS
+func WithDialOptions(opts ...grpc.DialOption) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.dialOpts = opts
+	}
+}
+
+// WithGRPCRegistry 设置节点对外提供的 Group 所在的 Registry，默认为 DefaultRegistry
+func WithGRPCRegistry(r *Registry) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.registry = r
+	}
+}
+
+func NewGRPCPool(self string, opts ...GRPCPoolOption) *GRPCPool {
+	p := &GRPCPool{
+		self:     self,
+		timeout:  defaultGRPCTimeout,
+		registry: DefaultRegistry,
+		dialOpts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set 更新 peer 列表，已存在的 peer 会继续复用原有连接
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		getters[peer] = &grpcGetter{addr: peer, timeout: p.timeout, dialOpts: p.dialOpts}
+	}
+	for peer, g := range p.grpcGetters {
+		if _, ok := getters[peer]; !ok {
+			g.close()
+		}
+	}
+	p.grpcGetters = getters
+}
+
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.grpcGetters[peer], true
+	}
+	return nil, false
+}
+
+func (p *GRPCPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.grpcGetters))
+	for peer, g := range p.grpcGetters {
+		if peer != p.self {
+			getters = append(getters, g)
+		}
+	}
+	return getters
+}
+
+// Serve 在 lis 上启动 gRPC 服务，阻塞直到服务退出。
+// GracefulStop 之后调用时关闭 lis 并返回 grpc.ErrServerStopped
+func (p *GRPCPool) Serve(lis net.Listener, opts ...grpc.ServerOption) error {
+	s := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(s, &grpcServer{pool: p})
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		lis.Close()
+		return grpc.ErrServerStopped
+	}
+	p.server = s
+	p.mu.Unlock()
+	p.Log("serving gRPC on %s", lis.Addr())
+	return s.Serve(lis)
+}
+
+// GracefulStop 停止 Serve 启动的服务，等待正在处理的请求完成后 Serve 返回 nil。
+// 在 Serve 之前调用时，之后的 Serve 不会启动服务
+func (p *GRPCPool) GracefulStop() {
+	p.mu.Lock()
+	p.stopped = true
+	s := p.server
+	p.mu.Unlock()
+	if s != nil {
+		s.GracefulStop()
+	}
+}
+
+var _ PeerPicker = (*GRPCPool)(nil)
+var _ PeerLister = (*GRPCPool)(nil)
+
+// grpcServer 实现 GroupCache 服务
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+func (s *grpcServer) group(name string) (*Group, error) {
+	group := s.pool.registry.Get(name)
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", name)
+	}
+	return group, nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	s.pool.Log("Get %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := group.GetContext(withPeerRequest(ctx), in.GetKey())
+	if errors.Is(err, ErrNotFound) {
+		return &pb.Response{Status: pb.Status_NOT_FOUND, Error: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	value, enc, err := wireValue(view, in.GetAcceptEncoding())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.Response{Value: value, Expire: expireNano(view.Expire()), Encoding: enc}, nil
+}
+
+func (s *grpcServer) GetMany(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	s.pool.Log("GetMany %s (%d keys)", in.GetGroup(), len(in.GetKeys()))
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	values, errs := group.GetManyContext(withPeerRequest(ctx), in.GetKeys())
+	return batchResponse(in.GetKeys(), values, errs, in.GetAcceptEncoding()), nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, in *pb.SetRequest) (*pb.Ack, error) {
+	s.pool.Log("Set %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.setLocally(ctx, in.GetKey(), BytesView{b: in.GetValue(), e: expireTime(in.GetExpire())})
+	return &pb.Ack{}, nil
+}
+
+func (s *grpcServer) Remove(ctx context.Context, in *pb.Request) (*pb.Ack, error) {
+	s.pool.Log("Remove %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.removeLocally(ctx, in.GetKey())
+	return &pb.Ack{}, nil
+}
+
+func (s *grpcServer) Invalidate(ctx context.Context, in *pb.Request) (*pb.Ack, error) {
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.Invalidate(in.GetKey())
+	return &pb.Ack{}, nil
+}
+
+var _ pb.GroupCacheServer = (*grpcServer)(nil)
+
+type grpcGetter struct {
+	addr     string
+	timeout  time.Duration
+	dialOpts []grpc.DialOption
+	mu       sync.Mutex
+	conn     *grpc.ClientConn
+}
+
+func (g *grpcGetter) client() (pb.GroupCacheClient, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		conn, err := grpc.NewClient(g.addr, g.dialOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to %s: %v", g.addr, err)
+		}
+		g.conn = conn
+	}
+	return pb.NewGroupCacheClient(g.conn), nil
+}
+
+func (g *grpcGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+}
+
+// Get 通过 gRPC 从远程 peer 获取数据
+func (g *grpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *grpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.call(ctx, func(ctx context.Context, client pb.GroupCacheClient) error {
+		res, err := client.Get(ctx, in)
+		if err != nil {
+			return err
+		}
+		proto.Reset(out)
+		proto.Merge(out, res)
+		return nil
+	})
+}
+
+func (g *grpcGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return g.call(ctx, func(ctx context.Context, client pb.GroupCacheClient) error {
+		res, err := client.GetMany(ctx, in)
+		if err != nil {
+			return err
+		}
+		proto.Reset(out)
+		proto.Merge(out, res)
+		return nil
+	})
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Ack) error {
+	return g.call(ctx, func(ctx context.Context, client pb.GroupCacheClient) error {
+		_, err := client.Set(ctx, in)
+		return err
+	})
+}
+
+func (g *grpcGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	return g.call(ctx, func(ctx context.Context, client pb.GroupCacheClient) error {
+		_, err := client.Remove(ctx, in)
+		return err
+	})
+}
+
+func (g *grpcGetter) Invalidate(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	return g.call(ctx, func(ctx context.Context, client pb.GroupCacheClient) error {
+		_, err := client.Invalidate(ctx, in)
+		return err
+	})
+}
+
+func (g *grpcGetter) call(ctx context.Context, fn func(context.Context, pb.GroupCacheClient) error) error {
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	return fn(ctx, client)
+}
+
+var _ PeerGetter = (*grpcGetter)(nil)
+var _ ContextPeerGetter = (*grpcGetter)(nil)
+var _ BatchPeerGetter = (*grpcGetter)(nil)
+var _ PeerSetter = (*grpcGetter)(nil)
@@ -0,0 +1,69 @@
+package geecache
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+	"google.golang.org/grpc"
+)
+
+func TestGRPCPool(t *testing.T) {
+	NewGroup("grpc-scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, nil
+		}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewGRPCPool(lis.Addr().String())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(lis) }()
+	t.Cleanup(func() {
+		server.GracefulStop()
+		if err := <-served; err != nil {
+			t.Errorf("Serve returned %v after GracefulStop", err)
+		}
+	})
+
+	client := NewGRPCPool("client")
+	client.Set(lis.Addr().String())
+	defer client.Set()
+
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatal("expected to pick remote peer")
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "grpc-scores", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.GetValue()) != "630" {
+		t.Fatalf("expected 630, got %s", res.GetValue())
+	}
+
+	if err := peer.Get(&pb.Request{Group: "unknown", Key: "Tom"}, res); err == nil {
+		t.Fatal("expected error for unknown group")
+	}
+}
+
+func TestGRPCStopBeforeServe(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewGRPCPool(lis.Addr().String())
+	server.GracefulStop()
+	if err := server.Serve(lis); !errors.Is(err, grpc.ErrServerStopped) {
+		t.Fatalf("Serve after GracefulStop = %v, want ErrServerStopped", err)
+	}
+	if _, err := net.Dial("tcp", lis.Addr().String()); err == nil {
+		t.Fatal("listener should be closed")
+	}
+}
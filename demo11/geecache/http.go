@@ -1,81 +1,378 @@
 package geecache
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/zsm/demo11/geecache/consistenthash"
 	pb "github.com/zsm/demo11/geecache/geecachepb"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
 const defaultBasePath = "/_geecache/"
 const defaultReplicas = 50
 
+const (
+	defaultMaxIdleConnsPerHost = 64
+	defaultDialTimeout         = 2 * time.Second
+	defaultResponseTimeout     = 5 * time.Second
+	defaultRequestTimeout      = 10 * time.Second
+	// defaultMaxBodySize 限制与 peer 之间单个请求体和响应体的大小
+	defaultMaxBodySize = 64 << 20
+)
+
+// metricsPath 位于 basePath 之下，以 Prometheus 文本格式导出所有 Group 的统计信息
+const metricsPath = "_metrics"
+
 type HTTPPool struct {
 	self        string
 	basePath    string
 	mu          sync.Mutex
-	peers       *consistenthash.Map
+	peers       consistenthash.Picker // 只包含健康的成员
+	newPicker   func() consistenthash.Picker
 	httpGetters map[string]*httpGetter
+	members     map[string]*member
+	replicas    int
+	retry       RetryPolicy
+	tlsConfig   *tls.Config
+	secret      []byte
+	client      *http.Client
+	// transport 为 nil 时使用 defaultTransport
+	transport      *http.Transport
+	requestTimeout time.Duration
+	maxBodySize    int64
+	breaker        CircuitBreaker
+	registry       *Registry
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+type HTTPPoolOption func(*HTTPPool)
+
+// WithReplicas 设置每个 key 的所有者数量，第一所有者不可用时依次尝试后面的所有者，
+// 需要哈希策略实现 consistenthash.MultiPicker
+func WithReplicas(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.replicas = n
+	}
+}
+
+// WithRetryPolicy 设置访问每个 peer 时默认的重试策略
+func WithRetryPolicy(policy RetryPolicy) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.retry = policy
+	}
+}
+
+// WithPicker 设置选择 peer 的哈希策略，默认为带虚拟节点的一致性哈希环
+func WithPicker(newPicker func() consistenthash.Picker) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.newPicker = newPicker
+	}
+}
+
+// WithTransport 设置访问 peer 使用的 Transport，用于调整连接池大小和各类超时，
+// 同时设置了 WithTLS 时会复制 t 并替换其 TLSClientConfig
+func WithTransport(t *http.Transport) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.transport = t
+	}
+}
+
+// WithRequestTimeout 设置访问 peer 时单次请求的总超时，包括读取响应体，0 表示不限制
+func WithRequestTimeout(d time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.requestTimeout = d
+	}
+}
+
+// WithMaxBodySize 限制与 peer 之间单个请求体和响应体的大小，超出的请求或响应直接失败，
+// 超出的请求返回 413。该限制同样适用于通过管理接口导入的快照
+func WithMaxBodySize(n int64) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.maxBodySize = n
+	}
+}
+
+// WithCircuitBreaker 设置每个 peer 的熔断策略，避免一个变慢的节点拖慢所有加载
+func WithCircuitBreaker(cb CircuitBreaker) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.breaker = cb
+	}
+}
+
+// WithRegistry 设置节点对外提供的 Group 所在的 Registry，默认为 DefaultRegistry
+func WithRegistry(r *Registry) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.registry = r
+	}
+}
+
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		newPicker: func() consistenthash.Picker {
+			return consistenthash.New(defaultReplicas, nil)
+		},
+		requestTimeout: defaultRequestTimeout,
+		maxBodySize:    defaultMaxBodySize,
+		breaker:        defaultCircuitBreaker,
+		registry:       DefaultRegistry,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	transport := p.transport
+	if transport == nil {
+		transport = defaultTransport()
+	}
+	if p.tlsConfig != nil {
+		transport = transport.Clone()
+		transport.TLSClientConfig = p.tlsConfig
 	}
+	p.client = &http.Client{Transport: transport, Timeout: p.requestTimeout}
+	return p
+}
+
+// defaultTransport 在 http.DefaultTransport 的基础上为每个 peer 保留更多空闲连接，并限制建连和等待响应的时间
+func defaultTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	t.DialContext = (&net.Dialer{Timeout: defaultDialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.ResponseHeaderTimeout = defaultResponseTimeout
+	return t
 }
 
 func (p *HTTPPool) Log(format string, v ...interface{}) {
 	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
+// Set 用 peers 替换全部成员，所有成员初始均视为健康
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
+	p.members = make(map[string]*member, len(peers))
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		p.members[peer] = &member{healthy: true}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	p.rebuildLocked()
+}
+
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL:     peer + p.basePath,
+		retry:       p.retry,
+		client:      p.client,
+		secret:      p.secret,
+		maxBodySize: p.maxBodySize,
+		breaker:     newBreaker(p.breaker),
+	}
+}
+
+// SetRetryPolicy 为单个 peer 设置重试策略，覆盖 WithRetryPolicy 的默认值
+func (p *HTTPPool) SetRetryPolicy(peer string, policy RetryPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if g, ok := p.httpGetters[peer]; ok {
+		g.mu.Lock()
+		g.retry = policy
+		g.mu.Unlock()
 	}
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+	// 使用转义后的路径切分，避免 key 中被转义的 / 被当作分隔符
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, p.basePath) {
+		http.NotFound(w, r)
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	if p.maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, p.maxBodySize)
+	}
+	rest := path[len(p.basePath):]
+	switch rest {
+	case metricsPath:
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			p.serveMetrics(w)
+		}
+		return
+	case healthPath:
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			w.Write([]byte("ok"))
+		}
+		return
+	}
+	// 健康检查和 metrics 不需要认证，方便负载均衡器和 Prometheus 访问
+	if err := p.authenticate(r); err != nil {
+		code := http.StatusUnauthorized
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if rest+"/" == adminPath || strings.HasPrefix(rest, adminPath) {
+		p.serveAdmin(w, r, rest)
+		return
+	}
+
 	// /<basepath>/<groupname>/<key> required
-	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
-	if len(parts) != 2 {
+	groupName, key, ok := strings.Cut(rest, "/")
+	if !ok {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	groupName, err1 := url.QueryUnescape(groupName)
+	key, err2 := url.QueryUnescape(key)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "bad escaping in path", http.StatusBadRequest)
+		return
+	}
 
-	groupName := parts[0]
-	key := parts[1]
-
-	group := GetGroup(groupName)
+	group := p.registry.Get(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
 
-	view, err := group.Get(key)
+	// POST /<groupname>/ 为批量获取，其余方法都需要 key
+	if key == "" {
+		if allowMethods(w, r, http.MethodPost) {
+			p.serveGetMany(w, r, group)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		p.serveGet(w, r, group, key)
+	case http.MethodHead:
+		p.serveHead(w, group, key)
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+	case http.MethodDelete:
+		p.serveRemove(w, r, group, key)
+	default:
+		allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// allowMethods 检查请求方法，不允许时返回 405 并设置 Allow 头
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	view, err := group.GetContext(withPeerRequest(r.Context()), key)
+	if errors.Is(err, ErrNotFound) {
+		writeProto(w, &pb.Response{Status: pb.Status_NOT_FOUND, Error: err.Error()})
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	value, enc, err := wireValue(view, parseEncodings(r.Header.Get(acceptEncodingHeader)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeProto(w, &pb.Response{Value: value, Expire: expireNano(view.Expire()), Encoding: enc})
+}
+
+// serveHead 只检查本节点是否缓存了 key，不会触发加载
+func (p *HTTPPool) serveHead(w http.ResponseWriter, group *Group, key string) {
+	if _, ok := group.lookupCache(key); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveGetMany 处理 POST 请求，请求体为 pb.BatchRequest
+func (p *HTTPPool) serveGetMany(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return
+	}
+	in := &pb.BatchRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	values, errs := group.GetManyContext(withPeerRequest(r.Context()), in.GetKeys())
+	writeProto(w, batchResponse(in.GetKeys(), values, errs, in.GetAcceptEncoding()))
+}
+
+// serveSet 处理 PUT 请求，请求体为 pb.SetRequest
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return
+	}
+	in := &pb.SetRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.setLocally(r.Context(), key, BytesView{b: in.GetValue(), e: expireTime(in.GetExpire())})
+	writeProto(w, &pb.Ack{})
+}
+
+// serveRemove 处理 DELETE 请求，带 invalidate 参数时只删除本地副本
+func (p *HTTPPool) serveRemove(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if r.URL.Query().Has("invalidate") {
+		group.Invalidate(key)
+	} else {
+		group.removeLocally(r.Context(), key)
+	}
+	writeProto(w, &pb.Ack{})
+}
+
+// readRequestBody 读取请求体，超过 maxBodySize 时返回 413
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return nil, false
+	}
+	return body, true
+}
+
+func writeProto(w http.ResponseWriter, m proto.Message) {
+	body, err := proto.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -85,51 +382,299 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+func (p *HTTPPool) serveMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := writeMetrics(w, p.registry.List()); err != nil {
+		p.Log("write metrics: %v", err)
+	}
+}
+
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+	return p.pickPeerLocked(key)
+}
+
+func (p *HTTPPool) PickPeers(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mp, ok := p.peers.(consistenthash.MultiPicker)
+	if !ok || p.replicas <= 1 {
+		if peer, ok := p.pickPeerLocked(key); ok {
+			return []PeerGetter{peer}
+		}
+		return nil
+	}
+	var getters []PeerGetter
+	for _, peer := range mp.GetN(key, p.replicas) {
+		if peer == p.self {
+			break
+		}
+		getters = append(getters, p.httpGetters[peer])
+	}
+	if len(getters) > 0 {
+		p.Log("Pick peers %d for %s", len(getters), key)
+	}
+	return getters
+}
+
+// PickOwner 返回 key 在哈希环上的所有者，Bounded 不会因负载而改选其他节点
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	var peer string
+	if o, ok := p.peers.(ownerLookup); ok {
+		peer = o.Owner(key)
+	} else {
+		peer = p.peers.Get(key)
+	}
+	if peer == "" || peer == p.self {
+		return nil, false
+	}
+	return p.httpGetters[peer], true
+}
+
+func (p *HTTPPool) pickPeerLocked(key string) (PeerGetter, bool) {
+	if p.peers == nil {
+		return nil, false
+	}
+	peer := p.peers.Get(key)
+	if peer == "" {
+		return nil, false
+	}
+	// Bounded 等按负载选择节点的策略需要在请求结束后释放负载，本地加载不计入负载
+	tracker, tracked := p.peers.(loadTracker)
+	if peer == p.self {
+		if tracked {
+			tracker.Done(peer)
+		}
+		return nil, false
+	}
+	p.Log("Pick peer %s", peer)
+	if tracked {
+		return &trackedGetter{PeerGetter: p.httpGetters[peer], done: func() { tracker.Done(peer) }}, true
+	}
+	return p.httpGetters[peer], true
+}
+
+func (p *HTTPPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, g := range p.httpGetters {
+		if peer != p.self && p.members[peer].healthy {
+			getters = append(getters, g)
+		}
 	}
-	return nil, false
+	return getters
 }
 
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ ReplicaPicker = (*HTTPPool)(nil)
+var _ OwnerPicker = (*HTTPPool)(nil)
+var _ PeerLister = (*HTTPPool)(nil)
 
 type httpGetter struct {
-	baseURL string
+	baseURL     string
+	client      *http.Client
+	secret      []byte //不为 nil 时为每个请求签名
+	maxBodySize int64  //0 表示不限制响应体大小
+	breaker     *breaker
+	mu          sync.Mutex
+	retry       RetryPolicy
 }
 
 // Get 方法用于从远程 peer 获取数据。
 // 它接收一个指向 pb.Request 的指针和一个指向 pb.Response 的指针，并返回一个错误。
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
+	return h.GetContext(context.Background(), in, out)
+}
+
+// GetContext 与 Get 相同，ctx 被取消时请求会立即中止
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	h.mu.Lock()
+	retry := h.retry
+	h.mu.Unlock()
+	u := h.url(in.GetGroup(), in.GetKey())
+	header := http.Header{}
+	if len(in.GetAcceptEncoding()) > 0 {
+		header.Set(acceptEncodingHeader, formatEncodings(in.GetAcceptEncoding()))
+	}
+	return retry.do(ctx, func() error {
+		return h.do(ctx, http.MethodGet, u, header, nil, out)
+	})
+}
+
+func (h *httpGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return h.do(ctx, http.MethodPost, h.url(in.GetGroup(), ""), nil, in, out)
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Ack) error {
+	return h.do(ctx, http.MethodPut, h.url(in.GetGroup(), in.GetKey()), nil, in, out)
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	return h.do(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey()), nil, nil, out)
+}
+
+func (h *httpGetter) Invalidate(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	return h.do(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey())+"?invalidate", nil, nil, out)
+}
+
+func (h *httpGetter) maxValueSize() int64 {
+	return h.maxBodySize
+}
+
+func (h *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
+}
+
+// do 发送请求，in 不为空时作为请求体，响应体解码到 out
+func (h *httpGetter) do(ctx context.Context, method, u string, header http.Header, in, out proto.Message) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = proto.Marshal(in); err != nil {
+			return fmt.Errorf("encoding request body: %v", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if h.secret != nil {
+		signRequest(req, h.secret, body)
+	}
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	probe, err := h.breaker.allow()
+	if err != nil {
+		return fmt.Errorf("%s: %w", h.baseURL, err)
+	}
+	err = h.roundTrip(client, req, out)
+	// 调用方放弃的请求不能说明 peer 有问题；4xx 说明 peer 正常响应
+	var status *statusError
+	h.breaker.done(probe, err == nil || errors.As(err, &status) && status.code < 500, ctx.Err() == nil)
+	return err
+}
+
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
 
-	res, err := http.Get(u)
+// roundTrip 发送请求并将响应体流式解码到 out，响应体超过 maxBodySize 时直接失败，
+// 读取完毕后再关闭，使连接可以被复用
+func (h *httpGetter) roundTrip(client *http.Client, req *http.Request, out proto.Message) error {
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+		return &statusError{code: res.StatusCode, status: res.Status}
+	}
+	if h.maxBodySize > 0 && res.ContentLength > h.maxBodySize {
+		return fmt.Errorf("response %w: %d > %d bytes", errBodyTooLarge, res.ContentLength, h.maxBodySize)
+	}
+	if err := decodeProto(res.Body, out, h.maxBodySize); err != nil {
+		return fmt.Errorf("decoding response body: %w", err)
 	}
+	return nil
+}
 
-	bytes, err := io.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+var errBodyTooLarge = errors.New("body too large")
+
+// decodeChunkSize 是 decodeProto 读取长字段时每次扩容的上限
+const decodeChunkSize = 64 << 10
+
+// decodeProto 逐个字段地从 r 中解码 m，同一时刻只缓存一个顶层字段，
+// 例如 BatchResponse 中的单个 item。limit 大于 0 时限制读取的总字节数，
+// 在为字段分配内存之前检查其声明的长度；为 0 时字段按实际读到的数据分块扩容
+func decodeProto(r io.Reader, m proto.Message, limit int64) error {
+	br := bufio.NewReader(r)
+	opts := proto.UnmarshalOptions{Merge: true}
+	var field []byte
+	var total int64
+	for {
+		tag, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		field = protowire.AppendVarint(field[:0], tag)
+		switch _, typ := protowire.DecodeTag(tag); typ {
+		case protowire.VarintType:
+			v, err := binary.ReadUvarint(br)
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			field = protowire.AppendVarint(field, v)
+		case protowire.Fixed32Type, protowire.Fixed64Type, protowire.BytesType:
+			var n uint64 = 4
+			if typ == protowire.Fixed64Type {
+				n = 8
+			} else if typ == protowire.BytesType {
+				if n, err = binary.ReadUvarint(br); err != nil {
+					return unexpectedEOF(err)
+				}
+				field = protowire.AppendVarint(field, n)
+			}
+			if limit > 0 && n > uint64(limit-total) {
+				return fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, limit)
+			}
+			// 按实际读到的数据分块扩容，声明的长度再大也不会提前分配
+			for n > 0 {
+				chunk := int(min(n, decodeChunkSize))
+				start := len(field)
+				field = slices.Grow(field, chunk)[:start+chunk]
+				if _, err := io.ReadFull(br, field[start:]); err != nil {
+					return unexpectedEOF(err)
+				}
+				n -= uint64(chunk)
+			}
+		default:
+			return fmt.Errorf("unsupported wire type %d", typ)
+		}
+		total += int64(len(field))
+		if limit > 0 && total > limit {
+			return fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, limit)
+		}
+		if err := opts.Unmarshal(field, m); err != nil {
+			return err
+		}
 	}
+}
 
-	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("decoding response body: %v", err)
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
 	}
-	return nil
+	return err
 }
 
 var _ PeerGetter = (*httpGetter)(nil)
+var _ ContextPeerGetter = (*httpGetter)(nil)
+var _ BatchPeerGetter = (*httpGetter)(nil)
+var _ PeerSetter = (*httpGetter)(nil)
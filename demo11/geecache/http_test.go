@@ -0,0 +1,678 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zsm/demo11/geecache/consistenthash"
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMetrics(t *testing.T) {
+	gee := NewGroup("metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+	gee.Get("Tom")
+
+	if s := gee.Stats(); s.Gets != 2 || s.CacheHits != 1 || s.LocalLoads != 1 || s.Bytes != 6 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	pool := NewHTTPPool("http://localhost:8001")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest("GET", defaultBasePath+metricsPath, nil))
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE geecache_gets_total counter",
+		`geecache_gets_total{group="metrics"} 2`,
+		`geecache_cache_hits_total{group="metrics"} 1`,
+		`geecache_bytes{group="metrics"} 6`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics output missing %q", line)
+		}
+	}
+}
+
+func TestHTTPSetRemove(t *testing.T) {
+	gee := NewGroup("http-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db"), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer srv.Close()
+
+	ctx := context.Background()
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if err := h.Set(ctx, &pb.SetRequest{Group: "http-set", Key: "Tom", Value: []byte("700")}, &pb.Ack{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get("Tom"); view.String() != "700" {
+		t.Fatalf("expected 700 after Set, got %s", view)
+	}
+	if err := h.Remove(ctx, &pb.Request{Group: "http-set", Key: "Tom"}, &pb.Ack{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get("Tom"); view.String() != "db" {
+		t.Fatalf("expected reload from getter after Remove, got %s", view)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	alive := httptest.NewServer(NewHTTPPool("alive"))
+	defer alive.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	pool := NewHTTPPool("self")
+	pool.Set("self", alive.URL, dead.URL)
+	client := &http.Client{}
+	for i := 0; i < healthCheckFailures; i++ {
+		pool.checkPeers(client)
+	}
+
+	for _, m := range pool.Members() {
+		if m.Healthy != (m.Addr != dead.URL) {
+			t.Fatalf("unexpected health of %s: %v", m.Addr, m.Healthy)
+		}
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam", "a", "b", "c", "d"} {
+		if peer := pool.peers.Get(key); peer == dead.URL {
+			t.Fatalf("unhealthy peer should be removed from the ring")
+		}
+	}
+	if n := len(pool.GetAll()); n != 1 {
+		t.Fatalf("expected 1 healthy remote peer, got %d", n)
+	}
+}
+
+func TestAdminPeers(t *testing.T) {
+	open := NewHTTPPool("http://localhost:8001")
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest("POST", defaultBasePath+adminPeersPath+"?peer=http://evil:8002", nil))
+	if w.Code != http.StatusForbidden || len(open.Members()) != 0 {
+		t.Fatalf("membership changes without authentication should be rejected, got %d", w.Code)
+	}
+
+	secret := []byte("secret")
+	pool := NewHTTPPool("http://localhost:8001", WithHMAC(secret))
+	pool.Set("http://localhost:8001")
+	signed := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		signRequest(req, secret, nil)
+		return req
+	}
+
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, signed("POST", defaultBasePath+adminPeersPath+"?peer=http://localhost:8002"))
+	var members []PeerStatus
+	if err := json.NewDecoder(w.Body).Decode(&members); err != nil || len(members) != 2 {
+		t.Fatalf("expected 2 members after POST, got %v %v", members, err)
+	}
+
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, signed("DELETE", defaultBasePath+adminPeersPath+"?peer=http://localhost:8001"))
+	members = pool.Members()
+	if len(members) != 1 || members[0].Addr != "http://localhost:8002" {
+		t.Fatalf("unexpected members after DELETE: %v", members)
+	}
+}
+
+func TestPickPeerBounded(t *testing.T) {
+	bounded := consistenthash.NewBounded(defaultReplicas, nil, 1.25)
+	pool := NewHTTPPool("self", WithPicker(func() consistenthash.Picker { return bounded }))
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	pool.Set("self", srv.URL)
+
+	for i := 0; i < 10; i++ {
+		peer, ok := pool.PickPeer("key" + strconv.Itoa(i))
+		if !ok {
+			continue
+		}
+		peer.(PeerSetter).Invalidate(context.Background(), &pb.Request{Group: "none", Key: "k"}, &pb.Ack{})
+	}
+	if l := bounded.Load("self") + bounded.Load(srv.URL); l != 0 {
+		t.Fatalf("all loads should be released, got %d", l)
+	}
+
+	// 写操作按环上的所有者路由，不受负载影响
+	for i := 0; i < 10; i++ {
+		key := "key" + strconv.Itoa(i)
+		peer, ok := pool.PickOwner(key)
+		if want := bounded.Owner(key); ok != (want == srv.URL) || ok && peer != pool.httpGetters[want] {
+			t.Fatalf("PickOwner(%s) = %v, %v, want %s", key, peer, ok, want)
+		}
+	}
+}
+
+func TestPickPeerJumpConsistent(t *testing.T) {
+	peers := []string{"http://a", "http://b", "http://c", "http://d", "http://e"}
+	newJump := WithPicker(func() consistenthash.Picker { return consistenthash.NewJump() })
+	p1 := NewHTTPPool(peers[0], newJump)
+	p1.Set(peers...)
+	p2 := NewHTTPPool(peers[1], newJump)
+	p2.Set(peers[4], peers[3], peers[2], peers[1], peers[0])
+	// 健康状态变化后重建哈希环也不能改变 key 的所有者
+	for _, healthy := range []bool{false, true} {
+		p2.mu.Lock()
+		p2.members[peers[2]].healthy = healthy
+		p2.rebuildLocked()
+		p2.mu.Unlock()
+	}
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if o1, o2 := p1.peers.Get(key), p2.peers.Get(key); o1 != o2 {
+			t.Fatalf("pools disagree on the owner of %s: %s vs %s", key, o1, o2)
+		}
+	}
+}
+
+func TestPickPeersReplicas(t *testing.T) {
+	pool := NewHTTPPool("self", WithReplicas(2))
+	pool.Set("self", "http://a", "http://b")
+
+	sawSecondary := false
+	for i := 0; i < 100; i++ {
+		owners := pool.PickPeers("key" + strconv.Itoa(i))
+		if len(owners) > 2 {
+			t.Fatalf("expected at most 2 remote owners, got %d", len(owners))
+		}
+		sawSecondary = sawSecondary || len(owners) == 2
+	}
+	if !sawSecondary {
+		t.Fatalf("expected some keys with two remote owners")
+	}
+}
+
+func TestHTTPGetMany(t *testing.T) {
+	NewGroup("http-batch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer srv.Close()
+
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	res := &pb.BatchResponse{}
+	err := h.GetMany(context.Background(), &pb.BatchRequest{Group: "http-batch", Keys: []string{"Tom", "unknown"}}, res)
+	if err != nil || len(res.Items) != 2 {
+		t.Fatalf("GetMany failed: %v %v", res, err)
+	}
+	if string(res.Items[0].Value) != "630" || res.Items[1].Error == "" {
+		t.Fatalf("unexpected items %v", res.Items)
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	src := NewGroup("admin-snapshot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	src.Get("Tom")
+
+	const target = defaultBasePath + adminSnapshotPath + "?group=admin-snapshot"
+	secret := []byte("secret")
+	signed := func(method string, body []byte) *http.Request {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		signRequest(req, secret, body)
+		return req
+	}
+	pool := NewHTTPPool("http://localhost:8001", WithHMAC(secret))
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, signed("GET", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export snapshot failed: %d %s", w.Code, w.Body)
+	}
+	snapshot := w.Body.Bytes()
+
+	open := NewHTTPPool("http://localhost:8001")
+	w = httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest("POST", target, bytes.NewReader(snapshot)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("import without authentication should be rejected, got %d", w.Code)
+	}
+
+	src.Invalidate("Tom")
+	w2 := httptest.NewRecorder()
+	pool.ServeHTTP(w2, signed("POST", snapshot))
+	if w2.Code != http.StatusOK || strings.TrimSpace(w2.Body.String()) != "1" {
+		t.Fatalf("import snapshot failed: %d %s", w2.Code, w2.Body)
+	}
+	if s := src.CacheStats(MainCache); s.Items != 1 {
+		t.Fatalf("snapshot should restore Tom, got %+v", s)
+	}
+
+	// 签名校验和 ReadSnapshot 读到超出限制的请求体时都返回 413
+	withTLS := NewHTTPPool("http://localhost:8001", WithMaxBodySize(8))
+	withTLS.tlsConfig = &tls.Config{}
+	for _, small := range []*HTTPPool{
+		withTLS,
+		NewHTTPPool("http://localhost:8001", WithMaxBodySize(8), WithHMAC(secret)),
+	} {
+		req := signed("POST", snapshot)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{nil}}
+		w3 := httptest.NewRecorder()
+		small.ServeHTTP(w3, req)
+		if w3.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("oversized snapshot should get 413, got %d %s", w3.Code, w3.Body)
+		}
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	large := strings.Repeat("geecache", 100)
+	NewGroup("http-compress", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(large), nil
+		}), WithCompression(Snappy, 64))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001"))
+	defer srv.Close()
+
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	for _, tt := range []struct {
+		accept []pb.Encoding
+		want   pb.Encoding
+	}{
+		{acceptEncodings, pb.Encoding_SNAPPY},
+		{nil, pb.Encoding_IDENTITY},
+		{[]pb.Encoding{pb.Encoding_GZIP}, pb.Encoding_IDENTITY},
+	} {
+		res := &pb.Response{}
+		if err := h.Get(&pb.Request{Group: "http-compress", Key: "k", AcceptEncoding: tt.accept}, res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Encoding != tt.want {
+			t.Fatalf("accept %v: got encoding %v, want %v", tt.accept, res.Encoding, tt.want)
+		}
+		v, err := peerValue(res.Value, res.Encoding, time.Time{}, 0)
+		if err != nil || v.String() != large {
+			t.Fatalf("accept %v: value mismatch: %v", tt.accept, err)
+		}
+	}
+	if _, err := peerValue([]byte("garbage"), pb.Encoding_ZSTD, time.Time{}, 0); err == nil {
+		t.Fatalf("corrupt compressed value should be rejected")
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	NewGroup("http-hmac", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithHMAC([]byte("secret"))))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		secret []byte
+		ok     bool
+	}{
+		{[]byte("secret"), true},
+		{[]byte("wrong"), false},
+		{nil, false},
+	} {
+		h := &httpGetter{baseURL: srv.URL + defaultBasePath, secret: tt.secret}
+		res := &pb.Response{}
+		err := h.Get(&pb.Request{Group: "http-hmac", Key: "Tom"}, res)
+		if tt.ok && (err != nil || string(res.Value) != "Tom") {
+			t.Fatalf("signed request failed: %v", err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "401")) {
+			t.Fatalf("secret %q: expected 401, got %v", tt.secret, err)
+		}
+	}
+
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath, secret: []byte("secret")}
+	res := &pb.BatchResponse{}
+	if err := h.GetMany(context.Background(), &pb.BatchRequest{Group: "http-hmac", Keys: []string{"Tom"}}, res); err != nil {
+		t.Fatalf("signed request with body failed: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + defaultBasePath + healthPath)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("health check should not require auth: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestLoadSnapshotFrom(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	srcReg, dstReg := NewRegistry(), NewRegistry()
+	src, _ := srcReg.NewGroup("warm", 2<<10, getter)
+	dst, _ := dstReg.NewGroup("warm", 2<<10, getter)
+	src.Get("Tom")
+	src.Get("Jack")
+
+	secret := WithHMAC([]byte("secret"))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001", secret, WithRegistry(srcReg)))
+	defer srv.Close()
+
+	if _, err := NewHTTPPool("http://localhost:8002").LoadSnapshotFrom(context.Background(), srv.URL, dst); err == nil {
+		t.Fatal("unsigned snapshot request should be rejected")
+	}
+	pool := NewHTTPPool("http://localhost:8002", secret, WithRegistry(dstReg))
+	if n, err := pool.LoadSnapshotFrom(context.Background(), srv.URL, dst); err != nil || n != 2 {
+		t.Fatalf("LoadSnapshotFrom = %d, %v", n, err)
+	}
+	if s := dst.CacheStats(MainCache); s.Items != 2 {
+		t.Fatalf("snapshot should warm dst, got %+v", s)
+	}
+	small := NewHTTPPool("http://localhost:8002", secret, WithRegistry(dstReg), WithMaxBodySize(2))
+	if _, err := small.LoadSnapshotFrom(context.Background(), srv.URL, dst); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("records over the body limit should fail, got %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	NewGroup("http-mtls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, dir, "ca", nil, nil)
+	newTestCert(t, dir, "node", ca, caKey)
+	cfg, err := NewMutualTLSConfig(dir+"/node.crt", dir+"/node.key", dir+"/ca.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewHTTPPool("https://127.0.0.1", WithTLS(cfg))
+	srv := httptest.NewUnstartedServer(pool)
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	h := pool.newGetter(srv.URL)
+	res := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: "http-mtls", Key: "Tom"}, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+
+	// 只信任 CA 但不提供客户端证书
+	noCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: cfg.RootCAs}}}
+	h = &httpGetter{baseURL: srv.URL + defaultBasePath, client: noCert}
+	if err := h.Get(&pb.Request{Group: "http-mtls", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatalf("request without client certificate should fail")
+	}
+}
+
+// newTestCert 在 dir 下生成 <name>.crt 和 <name>.key，parent 为 nil 时生成自签名的 CA
+func newTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(dir+"/"+name+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(dir+"/"+name+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestHTTPRouting(t *testing.T) {
+	gee := NewGroup("http routing", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001", "http://localhost:8002")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	for _, key := range []string{"a b", "a/b", "a+b", "a%2Fb", "?x=1#y", "键"} {
+		res := &pb.Response{}
+		if err := h.Get(&pb.Request{Group: "http routing", Key: key}, res); err != nil || string(res.Value) != "v:"+key {
+			t.Fatalf("key %q did not round-trip: %q %v", key, res.Value, err)
+		}
+	}
+
+	head := func(key string) int {
+		req, _ := http.NewRequest(http.MethodHead, h.url("http routing", key), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := head("a/b"); code != http.StatusOK {
+		t.Fatalf("HEAD cached key: got %d", code)
+	}
+	if code := head("never loaded"); code != http.StatusNotFound {
+		t.Fatalf("HEAD missing key: got %d", code)
+	}
+	if err := h.Invalidate(context.Background(), &pb.Request{Group: "http routing", Key: "a/b"}, &pb.Ack{}); err != nil {
+		t.Fatal(err)
+	}
+	if code := head("a/b"); code != http.StatusNotFound {
+		t.Fatalf("DELETE should invalidate a/b, HEAD got %d", code)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/unexpected", http.StatusNotFound},
+		{"GET", defaultBasePath + "http%20routing", http.StatusBadRequest},
+		{"GET", defaultBasePath + "nope/key", http.StatusNotFound},
+		{"PATCH", defaultBasePath + "http%20routing/key", http.StatusMethodNotAllowed},
+		{"GET", defaultBasePath + "http%20routing/", http.StatusMethodNotAllowed},
+		{"POST", defaultBasePath + metricsPath, http.StatusMethodNotAllowed},
+		{"GET", defaultBasePath + "_admin/unknown", http.StatusNotFound},
+		{"DELETE", defaultBasePath + adminGroupsPath, http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(tt.method, "http://localhost:8001"+tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest("GET", defaultBasePath+adminPath, nil))
+	var status NodeStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Self != "http://localhost:8001" || len(status.Peers) != 2 {
+		t.Fatalf("unexpected node status %+v", status)
+	}
+	found := false
+	for _, g := range status.Groups {
+		if g.Name == gee.Name() {
+			found = g.MainCache.Items == gee.CacheStats(MainCache).Items && g.MainCache.MaxBytes > 0
+		}
+	}
+	if !found {
+		t.Fatalf("admin status should list group %q with sizes: %+v", gee.Name(), status.Groups)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits atomic.Int64
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		writeProto(w, &pb.Response{Value: []byte("ok")})
+	}))
+	defer srv.Close()
+
+	pool := NewHTTPPool("http://localhost:8001", WithCircuitBreaker(CircuitBreaker{Failures: 2, Cooldown: 50 * time.Millisecond}))
+	h := pool.newGetter(srv.URL)
+	get := func() error {
+		return h.Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+	}
+	get()
+	get()
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || hits.Load() != 2 {
+		t.Fatalf("breaker should open after 2 failures, got %v with %d hits", err, hits.Load())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	healthy.Store(true)
+	if err := get(); err != nil {
+		t.Fatalf("probe after cooldown should succeed, got %v", err)
+	}
+	if err := get(); err != nil || hits.Load() != 4 {
+		t.Fatalf("breaker should close after a successful probe, got %v with %d hits", err, hits.Load())
+	}
+
+	b := newBreaker(CircuitBreaker{Failures: 1, Cooldown: time.Millisecond})
+	slow, _ := b.allow()
+	probe, _ := b.allow()
+	b.done(probe, false, true)
+	time.Sleep(2 * time.Millisecond)
+	if probe, err := b.allow(); !probe || err != nil {
+		t.Fatalf("breaker should let a probe through after cooldown, got %v %v", probe, err)
+	}
+	b.done(slow, false, true)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("only the probe should clear probing, got %v", err)
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	in := &pb.BatchResponse{Items: []*pb.BatchItem{
+		{Key: "Tom", Value: []byte("630"), Expire: 42},
+		{Key: "Jack", Error: "not found", Status: pb.Status_NOT_FOUND},
+	}}
+	b, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &pb.BatchResponse{}
+	if err := decodeProto(bytes.NewReader(b), out, 0); err != nil || !proto.Equal(in, out) {
+		t.Fatalf("decodeProto = %v, %v", out, err)
+	}
+	if err := decodeProto(bytes.NewReader(b[:len(b)-1]), &pb.BatchResponse{}, 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated body should fail, got %v", err)
+	}
+	if err := decodeProto(bytes.NewReader(b), &pb.BatchResponse{}, int64(len(b)-1)); !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("body over the limit should fail, got %v", err)
+	}
+	// 声明了 1GB 的 value 在分配内存之前就被拒绝
+	huge := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.BytesType), 1<<30)
+	if err := decodeProto(bytes.NewReader(huge), &pb.Response{}, 1<<20); !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("oversized field should fail, got %v", err)
+	}
+	// 不限制大小时，声明的长度超出实际数据或超出 int 范围都只会返回错误
+	for _, n := range []uint64{1 << 40, 1<<64 - 1} {
+		b := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.BytesType), n)
+		b = append(b, "short"...)
+		if err := decodeProto(bytes.NewReader(b), &pb.Response{}, 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("length %d: expected ErrUnexpectedEOF, got %v", n, err)
+		}
+	}
+}
+
+func TestHTTPClientLimits(t *testing.T) {
+	NewGroup("http-limits", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		writeProto(w, &pb.Response{Value: make([]byte, 1<<10)})
+	}))
+	defer srv.Close()
+
+	pool := NewHTTPPool("http://localhost:8001", WithMaxBodySize(512), WithRequestTimeout(50*time.Millisecond))
+	h := pool.newGetter(srv.URL)
+	res := &pb.Response{}
+	if err := h.do(context.Background(), http.MethodGet, srv.URL+"/g/k", nil, nil, res); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("oversized response should be rejected, got %v", err)
+	}
+	if err := h.do(context.Background(), http.MethodGet, srv.URL+"/g/k?slow", nil, nil, res); err == nil {
+		t.Fatalf("slow response should time out")
+	}
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodPut, defaultBasePath+"http-limits/k", strings.NewReader(strings.Repeat("x", 1<<10))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized request body should be rejected with 413, got %d", w.Code)
+	}
+}
+
+func TestHTTPRegistry(t *testing.T) {
+	r := NewRegistry()
+	if _, err := r.NewGroup("http-registry", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v:" + key), nil
+		})); err != nil {
+		t.Fatal(err)
+	}
+	pool := NewHTTPPool("http://localhost:8001", WithRegistry(r))
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	h := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	res := &pb.Response{}
+	if err := h.Get(&pb.Request{Group: "http-registry", Key: "Tom"}, res); err != nil || string(res.Value) != "v:Tom" {
+		t.Fatalf("Get = %q, %v", res.Value, err)
+	}
+	r.Remove("http-registry")
+	if err := h.Get(&pb.Request{Group: "http-registry", Key: "Tom"}, res); err == nil {
+		t.Fatal("removed group should no longer be served")
+	}
+}
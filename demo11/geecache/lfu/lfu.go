@@ -0,0 +1,174 @@
+package lfu
+
+import "container/list"
+
+// Cache 是按访问频次淘汰的缓存，频次相同时淘汰最久未访问的条目
+type Cache struct {
+	maxBytes  int64
+	nbytes    int64
+	cache     map[string]*list.Element
+	freqs     map[int]*list.List //访问频次 -> 该频次下的条目链表，表头为最近访问
+	minFreq   int
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key   string
+	value Value
+	freq  int
+}
+
+type Value = interface {
+	Len() int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		freqs:     make(map[int]*list.List),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		c.touch(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// touch 将条目的访问频次加一，移动到对应频次链表的表头
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	ll := c.freqs[kv.freq]
+	ll.Remove(ele)
+	if ll.Len() == 0 {
+		delete(c.freqs, kv.freq)
+		if c.minFreq == kv.freq {
+			c.minFreq++
+		}
+	}
+	kv.freq++
+	c.cache[kv.key] = c.list(kv.freq).PushFront(kv)
+}
+
+func (c *Cache) list(freq int) *list.List {
+	ll, ok := c.freqs[freq]
+	if !ok {
+		ll = list.New()
+		c.freqs[freq] = ll
+	}
+	return ll
+}
+
+func (c *Cache) RemoveOldest() {
+	ll, ok := c.freqs[c.minFreq]
+	if !ok {
+		return
+	}
+	if ele := ll.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveIf 删除所有 fn 返回 true 的条目，返回删除的数量
+func (c *Cache) RemoveIf(fn func(key string, value Value) bool) int {
+	var matched []*list.Element
+	for _, ll := range c.freqs {
+		for ele := ll.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if fn(kv.key, kv.value) {
+				matched = append(matched, ele)
+			}
+		}
+	}
+	for _, ele := range matched {
+		c.removeElement(ele)
+	}
+	return len(matched)
+}
+
+// Range 对每个条目调用 fn，fn 返回 false 时停止，不增加访问频次
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for _, ll := range c.freqs {
+		for ele := ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	ll := c.freqs[kv.freq]
+	ll.Remove(ele)
+	if ll.Len() == 0 {
+		delete(c.freqs, kv.freq)
+		if c.minFreq == kv.freq {
+			c.resetMinFreq()
+		}
+	}
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) resetMinFreq() {
+	c.minFreq = 0
+	for freq := range c.freqs {
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
+	}
+}
+
+func (c *Cache) Add(key string, value Value) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		c.touch(ele)
+	} else {
+		// 先淘汰再插入，否则新条目的频次最低，会被立即淘汰
+		size := int64(len(key)) + int64(value.Len())
+		for c.maxBytes != 0 && c.maxBytes < c.nbytes+size && len(c.cache) > 0 {
+			c.RemoveOldest()
+		}
+		kv := &entry{key: key, value: value, freq: 1}
+		c.cache[key] = c.list(1).PushFront(kv)
+		c.minFreq = 1
+		c.nbytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// SetMaxBytes 修改字节上限，缩小时立即淘汰超出的条目
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 返回当前占用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,89 @@
+package lfu
+
+import (
+	"reflect"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	lfu := New(int64(len("k1v1k2v2")), nil)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Get("k1")
+	lfu.Add("k3", String("v3"))
+
+	if _, ok := lfu.Get("k2"); ok || lfu.Len() != 2 {
+		t.Fatalf("least frequently used k2 should be evicted")
+	}
+	if _, ok := lfu.Get("k1"); !ok {
+		t.Fatalf("frequently used k1 should be kept")
+	}
+}
+
+func TestShiftingWorkingSet(t *testing.T) {
+	lfu := New(int64(len("ab")*2), nil)
+	lfu.Add("a", String("1"))
+	lfu.Add("b", String("1"))
+	lfu.Get("a")
+	lfu.Get("b")
+
+	// 缓存中都是频次不低于 2 的条目时，新的 key 仍然可以进入缓存
+	lfu.Add("c", String("1"))
+	if _, ok := lfu.Get("c"); !ok {
+		t.Fatalf("new key c should be admitted")
+	}
+	lfu.Get("c")
+	lfu.Add("d", String("1"))
+	if _, ok := lfu.Get("d"); !ok || lfu.Len() != 2 {
+		t.Fatalf("new key d should be admitted, len = %d", lfu.Len())
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	lfu := New(int64(10), callback)
+	lfu.Add("key1", String("123456"))
+	lfu.Add("k2", String("k2"))
+	lfu.Add("k3", String("k3"))
+	lfu.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key", String("1"))
+	lfu.Add("key", String("111"))
+	lfu.Add("k2", String("22"))
+	lfu.Remove("k2")
+
+	if lfu.Bytes() != int64(len("key")+len("111")) {
+		t.Fatal("expected 6 but got", lfu.Bytes())
+	}
+	if n := lfu.RemoveIf(func(string, Value) bool { return true }); n != 1 || lfu.Bytes() != 0 {
+		t.Fatalf("RemoveIf expected 1 removed, got %d", n)
+	}
+}
@@ -15,7 +15,8 @@ type entry struct {
 	value Value
 }
 
-type Value interface {
+// Value 定义为接口字面量的别名，使 lfu、twoq、arc 等包的 Value 与之是同一类型
+type Value = interface {
 	Len() int
 }
 
@@ -40,19 +41,54 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveIf 删除所有 fn 返回 true 的条目，返回删除的数量
+func (c *Cache) RemoveIf(fn func(key string, value Value) bool) int {
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		kv := ele.Value.(*entry)
+		if fn(kv.key, kv.value) {
+			c.removeElement(ele)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+// Range 从最旧到最新依次对每个条目调用 fn，fn 返回 false 时停止，不影响条目的顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
 		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		if !fn(kv.key, kv.value) {
+			return
 		}
 	}
 }
 
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
 func (c *Cache) Add(key string, value Value) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToBack(ele)
+		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
@@ -66,6 +102,19 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// SetMaxBytes 修改字节上限，缩小时立即淘汰超出的条目
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes 返回当前占用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -36,6 +36,24 @@ func TestRemoveoldest(t *testing.T) {
 	}
 }
 
+func TestUpdateKeepsRecent(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	cap := len(k1 + k2 + v1 + v2)
+	lru := New(int64(cap), nil)
+	lru.Add(k1, String(v1))
+	lru.Add(k2, String(v2))
+	lru.Add(k1, String("VALUE1"))
+	lru.Add(k3, String(v3))
+
+	if v, ok := lru.Get(k1); !ok || string(v.(String)) != "VALUE1" {
+		t.Fatalf("updated key1 should be kept as the most recent entry")
+	}
+	if _, ok := lru.Get(k2); ok {
+		t.Fatalf("key2 should be evicted as the oldest entry")
+	}
+}
+
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
 	callback := func(key string, value Value) {
@@ -63,3 +81,34 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nbytes)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	lru.Remove("key1")
+
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	if lru.nbytes != int64(len("key2")+len("5678")) {
+		t.Fatal("expected 8 but got", lru.nbytes)
+	}
+}
+
+func TestRemoveIf(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("a"))
+	lru.Add("k2", String("bb"))
+	lru.Add("k3", String("c"))
+
+	n := lru.RemoveIf(func(key string, value Value) bool {
+		return value.Len() == 1
+	})
+	if n != 2 || lru.Len() != 1 {
+		t.Fatalf("RemoveIf expected 2 removed, got %d", n)
+	}
+	if _, ok := lru.Get("k2"); !ok {
+		t.Fatalf("RemoveIf removed k2 unexpectedly")
+	}
+}
@@ -0,0 +1,184 @@
+package geecache
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// healthPath 供其他节点做健康检查
+	healthPath = "_health"
+	// adminPeersPath 用于查看和修改成员：GET 列出成员，POST/DELETE ?peer=<addr> 添加/删除成员
+	adminPeersPath = "_admin/peers"
+
+	defaultHealthCheckTimeout = time.Second
+	// healthCheckFailures 表示连续失败多少次后将 peer 从哈希环中摘除
+	healthCheckFailures = 2
+)
+
+type member struct {
+	healthy  bool
+	failures int
+}
+
+// PeerStatus 描述一个成员的状态
+type PeerStatus struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+}
+
+// rebuildLocked 用所有健康的成员重建哈希环，调用方需持有 p.mu。
+// 成员按地址排序后加入，保证 Jump 这类依赖加入顺序的策略在所有节点上得到相同的结果
+func (p *HTTPPool) rebuildLocked() {
+	p.peers = p.newPicker()
+	healthy := make([]string, 0, len(p.members))
+	for peer, m := range p.members {
+		if m.healthy {
+			healthy = append(healthy, peer)
+		}
+	}
+	sort.Strings(healthy)
+	p.peers.Add(healthy...)
+}
+
+// AddPeer 在运行时添加一个成员，已存在时不做任何事
+func (p *HTTPPool) AddPeer(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.members[peer]; ok {
+		return
+	}
+	if p.members == nil {
+		p.members = make(map[string]*member)
+		p.httpGetters = make(map[string]*httpGetter)
+	}
+	p.members[peer] = &member{healthy: true}
+	p.httpGetters[peer] = p.newGetter(peer)
+	p.rebuildLocked()
+	p.Log("peer %s added", peer)
+}
+
+// RemovePeer 在运行时删除一个成员
+func (p *HTTPPool) RemovePeer(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.members[peer]; !ok {
+		return
+	}
+	delete(p.members, peer)
+	delete(p.httpGetters, peer)
+	p.rebuildLocked()
+	p.Log("peer %s removed", peer)
+}
+
+// Members 返回按地址排序的所有成员及其健康状态
+func (p *HTTPPool) Members() []PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]PeerStatus, 0, len(p.members))
+	for peer, m := range p.members {
+		list = append(list, PeerStatus{Addr: peer, Healthy: m.healthy})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	return list
+}
+
+// StartHealthCheck 每隔 interval 检查一次其他成员，
+// 连续失败的成员会被暂时移出哈希环，恢复后重新加入，调用返回的函数可停止检查
+func (p *HTTPPool) StartHealthCheck(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	client := &http.Client{Timeout: min(interval, defaultHealthCheckTimeout), Transport: p.client.Transport}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkPeers(client)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (p *HTTPPool) checkPeers(client *http.Client) {
+	p.mu.Lock()
+	peers := make([]string, 0, len(p.members))
+	for peer := range p.members {
+		if peer != p.self {
+			peers = append(peers, peer)
+		}
+	}
+	p.mu.Unlock()
+
+	results := make([]bool, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			res, err := client.Get(peer + p.basePath + healthPath)
+			if err != nil {
+				return
+			}
+			res.Body.Close()
+			results[i] = res.StatusCode == http.StatusOK
+		}(i, peer)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changed := false
+	for i, peer := range peers {
+		m, ok := p.members[peer]
+		if !ok {
+			continue
+		}
+		if results[i] {
+			m.failures = 0
+			if !m.healthy {
+				m.healthy, changed = true, true
+				p.Log("peer %s recovered", peer)
+			}
+			continue
+		}
+		m.failures++
+		if m.healthy && m.failures >= healthCheckFailures {
+			m.healthy, changed = false, true
+			p.Log("peer %s is unhealthy", peer)
+		}
+	}
+	if changed {
+		p.rebuildLocked()
+	}
+}
+
+func (p *HTTPPool) serveAdminPeers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if !p.allowAdminWrite(w) {
+			return
+		}
+		peer := r.URL.Query().Get("peer")
+		if peer == "" {
+			http.Error(w, "peer is required", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			p.AddPeer(peer)
+		} else {
+			p.RemovePeer(peer)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, p.Members())
+}
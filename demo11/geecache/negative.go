@@ -0,0 +1,54 @@
+package geecache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound 表示 key 在数据源中不存在。Getter 返回的错误包装了 ErrNotFound 时，
+// 开启负缓存后该结果会被缓存，其他错误视为临时错误，不会被缓存
+var ErrNotFound = errors.New("geecache: not found")
+
+// negativeCacheFraction 表示负缓存从 mainCache 中划出 1/negativeCacheFraction 的字节
+const negativeCacheFraction = 16
+
+// notFoundError 是从负缓存或 peer 得到的 not-found 结果，保留原始的错误信息
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// WithNegativeTTL 开启负缓存，Getter 返回 ErrNotFound 的 key 在 ttl 内不会再次加载
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// lookupNegative 返回负缓存中 key 的 not-found 结果，未命中时返回 nil
+func (g *Group) lookupNegative(key string) error {
+	if g.negativeTTL <= 0 {
+		return nil
+	}
+	v, ok := g.negCache.get(key)
+	if !ok {
+		return nil
+	}
+	g.stats.negativeHits.Add(1)
+	return &notFoundError{msg: v.String()}
+}
+
+// cacheNegative 在 err 为 ErrNotFound 时缓存 not-found 结果
+func (g *Group) cacheNegative(key string, err error) {
+	if g.negativeTTL <= 0 || !errors.Is(err, ErrNotFound) {
+		return
+	}
+	g.negCache.add(key, BytesView{b: []byte(err.Error()), e: time.Now().Add(g.negativeTTL)})
+}
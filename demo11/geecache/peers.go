@@ -1,11 +1,144 @@
 package geecache
 
-import pb "github.com/zsm/demo11/geecache/geecachepb"
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// PeerLister 是 PeerPicker 的可选扩展，返回除自身以外的所有 peer，用于广播失效
+type PeerLister interface {
+	GetAll() []PeerGetter
+}
+
+// ReplicaPicker 由支持多副本的 PeerPicker 实现，返回 key 的所有者中排在本节点之前的 peer，
+// 按优先级排序；本节点是第一所有者时返回空。load 会依次尝试这些 peer，全部失败后才在本地加载
+type ReplicaPicker interface {
+	PickPeers(key string) []PeerGetter
+}
+
+// OwnerPicker 是 PeerPicker 的可选扩展，返回 key 在哈希环上固定的所有者，不受各节点负载的影响。
+// Set 和 Remove 按它路由，保证写操作总是落在同一个节点上
+type OwnerPicker interface {
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// ContextPeerGetter 是 PeerGetter 的可选扩展，请求可以感知调用方的超时和取消
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// BatchPeerGetter 是 PeerGetter 的可选扩展，一次获取多个 key，out.Items 与 in.Keys 一一对应
+type BatchPeerGetter interface {
+	GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+}
+
+// PeerSetter 是 PeerGetter 的可选扩展，支持写入和删除。
+// Set 和 Remove 由 key 的所属节点执行，并广播失效其他节点上的副本，Invalidate 只删除对方节点本地的副本
+type PeerSetter interface {
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.Ack) error
+	Remove(ctx context.Context, in *pb.Request, out *pb.Ack) error
+	Invalidate(ctx context.Context, in *pb.Request, out *pb.Ack) error
+}
+
+func errUnsupported(peer PeerGetter, op string) error {
+	return fmt.Errorf("peer %T does not support %s", peer, op)
+}
+
+// peerGet 在 peer 实现了 ContextPeerGetter 时带上 ctx 发送请求
+func peerGet(ctx context.Context, peer PeerGetter, in *pb.Request, out *pb.Response) error {
+	if cg, ok := peer.(ContextPeerGetter); ok {
+		return cg.GetContext(ctx, in, out)
+	}
+	return peer.Get(in, out)
+}
+
+type peerRequestKey struct{}
+
+// withPeerRequest 标记请求由其他节点转发而来。转发方已经选定本节点，这类请求总在本地加载，
+// 避免各节点对所有者的判断不一致（例如 Bounded 按各自的负载选择）时来回转发
+func withPeerRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerRequestKey{}, true)
+}
+
+func isPeerRequest(ctx context.Context) bool {
+	v, _ := ctx.Value(peerRequestKey{}).(bool)
+	return v
+}
+
+// ownerLookup 由按负载选择节点的 consistenthash.Picker 实现，返回不考虑负载时的所有者
+type ownerLookup interface {
+	Owner(key string) string
+}
+
+// loadTracker 由按负载选择节点的 consistenthash.Picker 实现，例如 consistenthash.Bounded
+type loadTracker interface {
+	Done(node string)
+}
+
+// trackedGetter 在第一次请求结束后调用 done 释放所选节点的负载
+type trackedGetter struct {
+	PeerGetter
+	once sync.Once
+	done func()
+}
+
+func (g *trackedGetter) release() {
+	g.once.Do(g.done)
+}
+
+func (g *trackedGetter) maxValueSize() int64 {
+	return valueLimit(g.PeerGetter)
+}
+
+func (g *trackedGetter) Get(in *pb.Request, out *pb.Response) error {
+	defer g.release()
+	return g.PeerGetter.Get(in, out)
+}
+
+func (g *trackedGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	defer g.release()
+	return peerGet(ctx, g.PeerGetter, in, out)
+}
+
+func (g *trackedGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	defer g.release()
+	if bg, ok := g.PeerGetter.(BatchPeerGetter); ok {
+		return bg.GetMany(ctx, in, out)
+	}
+	return errUnsupported(g.PeerGetter, "GetMany")
+}
+
+func (g *trackedGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Ack) error {
+	defer g.release()
+	if s, ok := g.PeerGetter.(PeerSetter); ok {
+		return s.Set(ctx, in, out)
+	}
+	return errUnsupported(g.PeerGetter, "Set")
+}
+
+func (g *trackedGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	defer g.release()
+	if s, ok := g.PeerGetter.(PeerSetter); ok {
+		return s.Remove(ctx, in, out)
+	}
+	return errUnsupported(g.PeerGetter, "Remove")
+}
+
+func (g *trackedGetter) Invalidate(ctx context.Context, in *pb.Request, out *pb.Ack) error {
+	defer g.release()
+	if s, ok := g.PeerGetter.(PeerSetter); ok {
+		return s.Invalidate(ctx, in, out)
+	}
+	return errUnsupported(g.PeerGetter, "Invalidate")
+}
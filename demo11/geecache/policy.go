@@ -0,0 +1,49 @@
+package geecache
+
+import (
+	"github.com/zsm/demo11/geecache/arc"
+	"github.com/zsm/demo11/geecache/lfu"
+	"github.com/zsm/demo11/geecache/lru"
+	"github.com/zsm/demo11/geecache/twoq"
+)
+
+// EvictionPolicy 是 cache 依赖的淘汰策略，
+// 实现需按 len(key)+value.Len() 统计字节数，超出 maxBytes 时淘汰条目并调用 onEvicted
+type EvictionPolicy interface {
+	Get(key string) (value lru.Value, ok bool)
+	Add(key string, value lru.Value)
+	Remove(key string)
+	RemoveIf(fn func(key string, value lru.Value) bool) int
+	// Range 遍历所有条目，fn 返回 false 时停止
+	Range(fn func(key string, value lru.Value) bool)
+	Len() int
+	Bytes() int64
+	// SetMaxBytes 在运行时修改字节上限
+	SetMaxBytes(maxBytes int64)
+}
+
+// Policy 根据字节上限和淘汰回调创建一个 EvictionPolicy
+type Policy func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy
+
+var (
+	LRU Policy = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	LFU Policy = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	TwoQueue Policy = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+	ARC Policy = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return arc.New(maxBytes, onEvicted)
+	}
+)
+
+// WithPolicy 设置 mainCache 和 hotCache 使用的淘汰策略，默认为 LRU
+func WithPolicy(policy Policy) GroupOption {
+	return func(g *Group) {
+		g.mainCache.policy = policy
+		g.hotCache.policy = policy
+	}
+}
@@ -0,0 +1,112 @@
+package geecache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/zsm/demo11/geecache/lru"
+)
+
+var policies = []struct {
+	name   string
+	policy Policy
+}{
+	{"LRU", LRU},
+	{"LFU", LFU},
+	{"2Q", TwoQueue},
+	{"ARC", ARC},
+}
+
+func TestPolicies(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			evicted := 0
+			ev := p.policy(int64(100), func(string, lru.Value) { evicted++ })
+			for i := 0; i < 50; i++ {
+				ev.Add(fmt.Sprintf("k%02d", i), BytesView{b: []byte("value")})
+			}
+			if ev.Bytes() > 100 || ev.Bytes() != int64(ev.Len()*8) {
+				t.Fatalf("unexpected bytes %d for %d entries", ev.Bytes(), ev.Len())
+			}
+			if evicted != 50-ev.Len() {
+				t.Fatalf("expected %d evictions, got %d", 50-ev.Len(), evicted)
+			}
+		})
+	}
+}
+
+func TestPolicySetMaxBytes(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			evicted := 0
+			ev := p.policy(int64(400), func(string, lru.Value) { evicted++ })
+			for i := 0; i < 50; i++ {
+				ev.Add(fmt.Sprintf("k%02d", i), BytesView{b: []byte("value")})
+			}
+			ev.SetMaxBytes(80)
+			if ev.Bytes() > 80 || evicted != 50-ev.Len() {
+				t.Fatalf("after shrinking: %d bytes, %d entries, %d evictions", ev.Bytes(), ev.Len(), evicted)
+			}
+			ev.SetMaxBytes(0)
+			for i := 0; i < 50; i++ {
+				ev.Add(fmt.Sprintf("n%02d", i), BytesView{b: []byte("value")})
+			}
+			if ev.Len() < 50 {
+				t.Fatalf("expected no limit after SetMaxBytes(0), got %d entries", ev.Len())
+			}
+		})
+	}
+}
+
+func TestPolicyRange(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			ev := p.policy(0, nil)
+			for i := 0; i < 10; i++ {
+				ev.Add(fmt.Sprintf("k%d", i), BytesView{b: []byte("v")})
+			}
+			ev.Get("k3")
+			seen := map[string]bool{}
+			ev.Range(func(key string, value lru.Value) bool {
+				seen[key] = true
+				return true
+			})
+			if len(seen) != 10 || ev.Len() != 10 {
+				t.Fatalf("Range visited %d of %d entries", len(seen), ev.Len())
+			}
+			n := 0
+			ev.Range(func(string, lru.Value) bool {
+				n++
+				return n < 3
+			})
+			if n != 3 {
+				t.Fatalf("Range should stop when fn returns false, visited %d", n)
+			}
+		})
+	}
+}
+
+// BenchmarkPolicyHitRate 在 Zipf 分布的访问序列下比较各淘汰策略的命中率
+func BenchmarkPolicyHitRate(b *testing.B) {
+	const keys = 10000
+	value := BytesView{b: make([]byte, 64)}
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			r := rand.New(rand.NewSource(1))
+			zipf := rand.NewZipf(r, 1.1, 1, keys-1)
+			ev := p.policy(int64(keys/10*70), nil)
+			hits := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("%05d", zipf.Uint64())
+				if _, ok := ev.Get(key); ok {
+					hits++
+				} else {
+					ev.Add(key, value)
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(b.N)*100, "hit%")
+		})
+	}
+}
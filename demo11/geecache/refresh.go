@@ -0,0 +1,62 @@
+package geecache
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WithStaleWhileRevalidate 使过期不超过 window 的条目仍可被读取：
+// 读取时立即返回旧值，同时在后台重新加载
+func WithStaleWhileRevalidate(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.staleWindow = window
+		g.hotCache.staleWindow = window
+	}
+}
+
+// WithRefreshAhead 在条目剩余的有效期不足 fraction（0~1）时，读取会触发后台刷新，
+// 使热点 key 在过期之前就被更新
+func WithRefreshAhead(fraction float64) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = fraction
+	}
+}
+
+// needsRefresh 判断命中的条目是否需要在后台刷新
+func (g *Group) needsRefresh(v BytesView) bool {
+	if v.e.IsZero() {
+		return false
+	}
+	now := time.Now()
+	if v.expired(now) {
+		g.stats.staleHits.Add(1)
+		return true
+	}
+	if g.refreshAhead <= 0 {
+		return false
+	}
+	lifetime := v.ttl
+	if lifetime <= 0 {
+		lifetime = g.ttl
+	}
+	return v.e.Sub(now) < time.Duration(float64(lifetime)*g.refreshAhead)
+}
+
+// refreshAsync 在后台重新加载 key，同一个 key 同时只有一个刷新。
+// 加载与请求路径上的 load 共用 singleflight，不会重复访问数据源
+func (g *Group) refreshAsync(key string) {
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer g.refreshing.Delete(key)
+		if _, err := g.load(context.Background(), key); err != nil {
+			log.Println("[GeeCache] Failed to refresh", key, err)
+			return
+		}
+		// 从 peer 加载的值不一定会放入 hotCache，删除旧值避免继续返回过期数据
+		g.hotCache.remove(key)
+	}()
+}
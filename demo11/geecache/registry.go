@@ -0,0 +1,74 @@
+package geecache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrGroupExists 表示 Registry 中已存在同名的 Group
+var ErrGroupExists = errors.New("geecache: group already exists")
+
+// Registry 按名称管理一组 Group，HTTPPool 和 GRPCPool 从中查找请求的 Group
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// DefaultRegistry 是 NewGroup、GetGroup 以及未指定 Registry 的节点使用的 Registry
+var DefaultRegistry = NewRegistry()
+
+// NewGroup 创建并注册一个 Group，同名的 Group 已存在时返回 ErrGroupExists
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) (*Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.groups[name]; ok {
+		return nil, ErrGroupExists
+	}
+	g := newGroup(name, cacheBytes, getter, opts...)
+	r.groups[name] = g
+	return g, nil
+}
+
+func (r *Registry) Get(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// Remove 注销并关闭名为 name 的 Group，Group 不存在时返回 false
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	g, ok := r.groups[name]
+	delete(r.groups, name)
+	r.mu.Unlock()
+	if ok {
+		g.close()
+	}
+	return ok
+}
+
+// List 返回按名称排序的所有 Group
+func (r *Registry) List() []*Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	gs := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+// put 注册 g 并返回被替换的同名 Group
+func (r *Registry) put(g *Group) *Group {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.groups[g.name]
+	r.groups[g.name] = g
+	return old
+}
@@ -0,0 +1,52 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy 控制访问 peer 失败时的重试，零值表示不重试
+type RetryPolicy struct {
+	Attempts   int           // 总尝试次数，<=1 表示不重试
+	Backoff    time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxBackoff time.Duration // 等待时间的上限，0 表示不限制
+}
+
+// do 执行 fn 直到成功、出现不可重试的错误、达到尝试次数或 ctx 结束
+func (r RetryPolicy) do(ctx context.Context, fn func() error) error {
+	backoff := r.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= r.Attempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if backoff > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+			backoff *= 2
+			if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+				backoff = r.MaxBackoff
+			}
+		}
+	}
+}
+
+// retryable 只对传输错误、5xx 和 429 重试。熔断时重试没有意义，直接交给调用方尝试其他节点；
+// 其他 4xx 和响应过大时重试也会得到同样的结果
+func retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, errBodyTooLarge) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500 || status.code == http.StatusTooManyRequests
+	}
+	return true
+}
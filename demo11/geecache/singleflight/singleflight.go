@@ -1,11 +1,48 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// errGoexit 表示 fn 调用了 runtime.Goexit
+var errGoexit = errors.New("runtime.Goexit was called")
+
+// PanicError 是 fn 发生 panic 时所有调用方收到的值，
+// Do 和 DoContext 会以它重新 panic，DoChan 则通过 Result.Err 返回
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// Result 是 DoChan 返回的结果，Shared 表示结果是否被多个调用方共享
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
 
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int // 仍在等待结果的调用方，为 0 时取消 fn
+	dups    int // 加入到这次调用的调用方总数，不随调用方离开减少
+	chans   []chan<- Result
+	cancel  context.CancelFunc
 }
 
 type Group struct {
@@ -13,27 +50,155 @@ type Group struct {
 	m  map[string]*call
 }
 
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	return g.DoContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// DoContext 与 Do 相同，但每个调用方只等待到自己的 ctx 结束为止。
+// fn 收到的 ctx 不随某个调用方取消，只有当所有调用方都放弃等待时才会被取消。
+func (g *Group) DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	c := g.join(ctx, key, fn, nil)
+	select {
+	case <-c.done:
+		if e, ok := c.err.(*PanicError); ok {
+			panic(e)
+		}
+		if c.err == errGoexit {
+			// 与直接调用 fn 的行为保持一致
+			runtime.Goexit()
+		}
+		g.mu.Lock()
+		shared = c.dups > 0
+		g.mu.Unlock()
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.leave(key, c)
+		return nil, ctx.Err(), false
+	}
+}
+
+// DoChan 与 Do 相同，但不阻塞，结果通过返回的 channel 送达
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.join(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	}, ch)
+	return ch
+}
+
+// Forget 使 key 之后的调用不再等待正在进行的调用，而是重新执行 fn，
+// 已经在等待的调用方仍会收到原来的结果
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
+
+// Claim 在 key 没有正在进行的调用时登记一个由调用方自己完成的调用，
+// 期间其他调用方会等待 complete 提交的结果；key 已有调用在进行时返回 ok 为 false。
+// 调用方必须保证 complete 最终被调用，多次调用只有第一次生效
+func (g *Group) Claim(key string) (complete func(val interface{}, err error), ok bool) {
 	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if _, ok := g.m[key]; ok {
+		return nil, false
+	}
+	// 登记者本身算作一个不会离开的调用方，其他调用方离开时不会取消这次调用
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: func() {}}
+	g.m[key] = c
+	var once sync.Once
+	return func(val interface{}, err error) {
+		once.Do(func() {
+			c.val, c.err = val, err
+			g.finish(c, key)
+		})
+	}, true
+}
+
+// join 加入 key 正在进行的调用，没有时启动一个新的调用
+func (g *Group) join(ctx context.Context, key string, fn func(context.Context) (interface{}, error), ch chan<- Result) *call {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		c.waiters++
+		c.dups++
+		if ch != nil {
+			c.chans = append(c.chans, ch)
+		}
+		return c
+	}
+	fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	if ch != nil {
+		c.chans = append(c.chans, ch)
 	}
-	c := new(call)
-	c.wg.Add(1)
 	g.m[key] = c
-	g.mu.Unlock()
+	go g.doCall(fctx, c, key, fn)
+	return c
+}
 
-	c.val, c.err = fn()
-	c.wg.Done()
+// leave 在调用方放弃等待时调用，最后一个调用方离开时取消 fn
+func (g *Group) leave(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.cancel()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+	}
+}
+
+func (g *Group) doCall(ctx context.Context, c *call, key string, fn func(context.Context) (interface{}, error)) {
+	normalReturn := false
+	recovered := false
+
+	// 用两层 defer 区分 panic 和 runtime.Goexit：
+	// Goexit 时 recover 返回 nil，且 normalReturn 和 recovered 都为 false
+	defer func() {
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+		g.finish(c, key)
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn(ctx)
+		normalReturn = true
+	}()
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// finish 结束调用并将结果交给所有调用方
+func (g *Group) finish(c *call, key string) {
+	c.cancel()
 
 	g.mu.Lock()
-	delete(g.m, key)
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	shared := c.dups > 0
+	for _, ch := range c.chans {
+		ch <- Result{Val: c.val, Err: c.err, Shared: shared}
+	}
 	g.mu.Unlock()
-
-	return c.val, c.err
+	close(c.done)
 }
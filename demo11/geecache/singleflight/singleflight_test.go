@@ -1 +1,280 @@
 package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+}
+
+func TestDoErr(t *testing.T) {
+	var g Group
+	someErr := errors.New("some error")
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	})
+	if err != someErr || v != nil {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var started, wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	for i := 0; i < n; i++ {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			v, err, shared := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	started.Wait()
+	// 等待所有调用方加入同一次调用
+	for {
+		g.mu.Lock()
+		c := g.m["key"]
+		joined := c != nil && c.waiters == n
+		g.mu.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("fn called %d times, want 1", calls.Load())
+	}
+	if sharedCount.Load() != n {
+		t.Fatalf("%d callers saw shared=true, want %d", sharedCount.Load(), n)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		t.Error("second fn should not be called")
+		return nil, nil
+	})
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		select {
+		case res := <-ch:
+			if res.Val != "bar" || res.Err != nil || !res.Shared {
+				t.Fatalf("DoChan = %+v", res)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("DoChan did not deliver a result")
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	first := make(chan struct{})
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		close(first)
+		<-release
+		return 1, nil
+	})
+	<-first
+
+	g.Forget("key")
+	v, _, shared := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 || shared {
+		t.Fatalf("Do after Forget = %v, %v, want a fresh call", v, shared)
+	}
+
+	close(release)
+	if res := <-ch1; res.Val != 1 {
+		t.Fatalf("forgotten call should still deliver to its waiters, got %+v", res)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	var panics atomic.Int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					if pe, ok := r.(*PanicError); !ok || pe.Value != "boom" || len(pe.Stack) == 0 {
+						t.Errorf("unexpected panic value %#v", r)
+					}
+					panics.Add(1)
+				}
+			}()
+			g.Do("key", fn)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if panics.Load() != n {
+		t.Fatalf("%d callers panicked, want %d", panics.Load(), n)
+	}
+
+	res := <-g.DoChan("key", func() (interface{}, error) {
+		panic("boom")
+	})
+	if pe, ok := res.Err.(*PanicError); !ok || pe.Value != "boom" {
+		t.Fatalf("DoChan should report the panic as an error, got %v", res.Err)
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Group
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do("key", func() (interface{}, error) {
+			runtime.Goexit()
+			return nil, nil
+		})
+		t.Error("Do should not return after fn called runtime.Goexit")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiter hung after fn called runtime.Goexit")
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	canceled := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			close(canceled)
+			return nil, ctx.Err()
+		case <-release:
+			return "bar", nil
+		}
+	}
+
+	// 一个调用方放弃等待不影响其他调用方
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	res2 := make(chan interface{}, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctx1, "key", fn)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("canceled caller got %v", err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "key", fn)
+		res2 <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if v := <-res2; v != "bar" {
+		t.Fatalf("remaining caller got %v", v)
+	}
+
+	// 所有调用方都放弃后 fn 被取消
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release = make(chan struct{})
+	if _, err, _ := g.DoContext(ctx, "key2", fn); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("fn was not canceled after all callers gave up")
+	}
+}
+
+func TestClaim(t *testing.T) {
+	var g Group
+	complete, ok := g.Claim("key")
+	if !ok {
+		t.Fatal("Claim on an idle key should succeed")
+	}
+	if _, ok := g.Claim("key"); ok {
+		t.Fatal("second Claim should fail while the key is claimed")
+	}
+
+	res := make(chan interface{}, 1)
+	go func() {
+		v, _, shared := g.Do("key", func() (interface{}, error) {
+			t.Error("fn should not run while the key is claimed")
+			return nil, nil
+		})
+		if !shared {
+			t.Error("waiter of a claimed key should see shared=true")
+		}
+		res <- v
+	}()
+	for {
+		g.mu.Lock()
+		joined := g.m["key"].waiters == 2
+		g.mu.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	complete("bar", nil)
+	complete("ignored", nil)
+	if v := <-res; v != "bar" {
+		t.Fatalf("waiter got %v, want bar", v)
+	}
+	if _, ok := g.Claim("key"); !ok {
+		t.Fatal("key should be claimable again after complete")
+	}
+}
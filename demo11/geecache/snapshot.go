@@ -0,0 +1,327 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zsm/demo11/geecache/lru"
+)
+
+// 快照格式：
+//
+//	magic "GCSN" | version uint8 | entry... | end
+//	entry: 1 | uvarint len(key) | key | uvarint len(value) | value | varint expire | crc32(entry)
+//	end:   0 | uvarint count | crc32(end)
+//
+// 每条记录单独校验，expire 为 UnixNano，0 表示永不过期
+const (
+	snapshotMagic   = "GCSN"
+	snapshotVersion = 1
+
+	snapshotEntry = 1
+	snapshotEnd   = 0
+
+	// maxSnapshotValueSize 是从文件导入快照时单条记录的上限，
+	// 通过 HTTP 导入时使用 pool 的 maxBodySize
+	maxSnapshotValueSize = 1 << 30
+
+	// adminSnapshotPath 用于导出和导入快照：GET ?group=<name> 导出，POST ?group=<name> 导入请求体，
+	// 导入的快照同样受 WithMaxBodySize 限制，超出时返回 413，更大的快照需在节点上用 LoadSnapshot 导入
+	adminSnapshotPath = "_admin/snapshot"
+)
+
+var ErrBadSnapshot = errors.New("geecache: bad snapshot")
+
+type cacheEntry struct {
+	key   string
+	value BytesView
+}
+
+// entries 返回 cache 中的所有条目，LRU 等策略下按从旧到新的顺序排列
+func (c *cache) entries() []cacheEntry {
+	c.init()
+	var entries []cacheEntry
+	for _, sh := range c.shards {
+		sh.mu.Lock()
+		sh.ev.Range(func(key string, value lru.Value) bool {
+			entries = append(entries, cacheEntry{key, value.(BytesView)})
+			return true
+		})
+		sh.mu.Unlock()
+	}
+	return entries
+}
+
+// WriteSnapshot 将 mainCache 中未过期的条目写入 w，返回写入的条目数
+func (g *Group) WriteSnapshot(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+
+	now := time.Now()
+	n := 0
+	var buf []byte
+	for _, e := range g.mainCache.entries() {
+		if e.value.expired(now) {
+			continue
+		}
+		buf = append(buf[:0], snapshotEntry)
+		buf = binary.AppendUvarint(buf, uint64(len(e.key)))
+		buf = append(buf, e.key...)
+		value, err := e.value.bytes()
+		if err != nil {
+			return n, fmt.Errorf("decoding %s: %w", e.key, err)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+		buf = binary.AppendVarint(buf, expireNano(e.value.e))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+		if _, err := bw.Write(buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+	buf = append(buf[:0], snapshotEnd)
+	buf = binary.AppendUvarint(buf, uint64(n))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	bw.Write(buf)
+	return n, bw.Flush()
+}
+
+// ReadSnapshot 从 r 读取快照并写入 mainCache，已过期的条目会被跳过，返回载入的条目数。
+// 快照损坏时返回 ErrBadSnapshot，在此之前校验通过的条目仍会保留
+func (g *Group) ReadSnapshot(r io.Reader) (int, error) {
+	return g.readSnapshot(r, maxSnapshotValueSize)
+}
+
+// readSnapshot 与 ReadSnapshot 相同，但 key 或 value 超过 limit 字节时返回 ErrBadSnapshot
+func (g *Group) readSnapshot(r io.Reader, limit int64) (int, error) {
+	d := &snapshotDecoder{r: bufio.NewReader(r), limit: limit}
+	var header [len(snapshotMagic) + 1]byte
+	if _, d.err = io.ReadFull(d.r, header[:]); d.err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, d.corrupt("missing header")
+	}
+	if v := header[len(snapshotMagic)]; v != snapshotVersion {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, v)
+	}
+
+	now := time.Now()
+	n, total := 0, 0
+	for {
+		d.crc = crc32.NewIEEE()
+		tag, err := d.ReadByte()
+		if err != nil {
+			return n, d.corrupt("truncated")
+		}
+		if tag == snapshotEnd {
+			count := d.uvarint()
+			if !d.checksum() || count != uint64(total) {
+				return n, d.corrupt("bad trailer")
+			}
+			return n, nil
+		}
+		if tag != snapshotEntry {
+			return n, fmt.Errorf("%w: unexpected record type %d", ErrBadSnapshot, tag)
+		}
+		key := string(d.bytes())
+		value := BytesView{b: d.bytes(), e: expireTime(d.varint())}
+		if d.err != nil {
+			return n, d.corrupt(fmt.Sprintf("reading entry %d", total))
+		}
+		if !d.checksum() {
+			return n, d.corrupt(fmt.Sprintf("checksum mismatch for entry %d", total))
+		}
+		total++
+		if value.expired(now) {
+			continue
+		}
+		g.populateCache(key, value)
+		n++
+	}
+}
+
+// snapshotDecoder 在读取的同时计算校验和，出错后的读取均返回零值，
+// 错误由 checksum 统一报告
+type snapshotDecoder struct {
+	r     *bufio.Reader
+	crc   hash.Hash32
+	err   error
+	limit int64 // 单个 key 或 value 的最大字节数
+}
+
+func (d *snapshotDecoder) ReadByte() (byte, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	if d.err == nil {
+		d.crc.Write([]byte{b})
+	}
+	return b, d.err
+}
+
+func (d *snapshotDecoder) uvarint() uint64 {
+	v, err := binary.ReadUvarint(d)
+	if err != nil {
+		d.err = err
+	}
+	return v
+}
+
+func (d *snapshotDecoder) varint() int64 {
+	v, err := binary.ReadVarint(d)
+	if err != nil {
+		d.err = err
+	}
+	return v
+}
+
+func (d *snapshotDecoder) bytes() []byte {
+	size := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if size > uint64(d.limit) {
+		d.err = fmt.Errorf("record of %d bytes exceeds the %d byte limit", size, d.limit)
+		return nil
+	}
+	// 长度字段可能已损坏，按实际读到的数据增长缓冲区，而不是预先分配 size 字节
+	var buf bytes.Buffer
+	if _, d.err = io.CopyN(&buf, d.r, int64(size)); d.err != nil {
+		if d.err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	d.crc.Write(buf.Bytes())
+	return buf.Bytes()
+}
+
+// corrupt 返回 ErrBadSnapshot，读取出错时同时包装该错误，方便调用方区分请求体过大等情况
+func (d *snapshotDecoder) corrupt(msg string) error {
+	if d.err != nil && d.err != io.EOF && d.err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %s: %w", ErrBadSnapshot, msg, d.err)
+	}
+	return fmt.Errorf("%w: %s", ErrBadSnapshot, msg)
+}
+
+func (d *snapshotDecoder) checksum() bool {
+	if d.err != nil {
+		return false
+	}
+	sum := d.crc.Sum32()
+	var b [4]byte
+	if _, d.err = io.ReadFull(d.r, b[:]); d.err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(b[:]) == sum
+}
+
+// SaveSnapshot 将快照写入 path，先写临时文件再重命名，避免留下不完整的快照
+func (g *Group) SaveSnapshot(path string) (int, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	n, err := g.WriteSnapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+// LoadSnapshot 从 path 读取快照并写入 mainCache
+func (g *Group) LoadSnapshot(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return g.ReadSnapshot(f)
+}
+
+// LoadSnapshotFrom 通过 peer 的 admin 接口拉取 g 的快照并写入 mainCache，
+// 请求使用本节点的 TLS 配置和签名，通常在加入哈希环之前用来预热缓存
+func (p *HTTPPool) LoadSnapshotFrom(ctx context.Context, peer string, g *Group) (int, error) {
+	u := peer + p.basePath + adminSnapshotPath + "?group=" + url.QueryEscape(g.Name())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if p.secret != nil {
+		signRequest(req, p.secret, nil)
+	}
+	// 快照可能很大，不使用 p.client 的总超时，由 ctx 控制
+	client := &http.Client{Transport: p.client.Transport}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server returned: %v", res.Status)
+	}
+	return g.readSnapshot(res.Body, p.snapshotRecordLimit())
+}
+
+// snapshotRecordLimit 返回通过 HTTP 导入快照时单条记录的上限，与单个请求体的上限相同
+func (p *HTTPPool) snapshotRecordLimit() int64 {
+	if p.maxBodySize > 0 {
+		return p.maxBodySize
+	}
+	return maxSnapshotValueSize
+}
+
+func (p *HTTPPool) serveAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("group")
+	group := p.registry.Get(name)
+	if group == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if _, err := group.WriteSnapshot(w); err != nil {
+			p.Log("write snapshot of %s: %v", name, err)
+		}
+	case http.MethodPost:
+		if !p.allowAdminWrite(w) {
+			return
+		}
+		n, err := group.readSnapshot(r.Body, p.snapshotRecordLimit())
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			msg := fmt.Sprintf("snapshot exceeds the %d byte request limit, import it with LoadSnapshot on the node instead", tooLarge.Limit)
+			http.Error(w, msg, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%d\n", n)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+type groupStats struct {
+	gets          atomic.Int64
+	cacheHits     atomic.Int64
+	loads         atomic.Int64
+	loadsDeduped  atomic.Int64
+	peerLoads     atomic.Int64
+	peerErrors    atomic.Int64
+	localLoads    atomic.Int64
+	localLoadErrs atomic.Int64
+	negativeHits  atomic.Int64
+	staleHits     atomic.Int64
+	refreshes     atomic.Int64
+}
+
+// Stats 是 Group 的统计信息快照
+type Stats struct {
+	Gets          int64 // 所有 Get 请求
+	CacheHits     int64 // mainCache、hotCache 或负缓存命中
+	Loads         int64 // 未命中缓存，需要加载 (gets - cacheHits)
+	LoadsDeduped  int64 // 经过 singleflight 合并后实际执行的加载
+	Dedupes       int64 // 被 singleflight 合并掉的加载 (loads - loadsDeduped)
+	PeerLoads     int64 // 从 peer 加载成功
+	PeerErrors    int64 // 从 peer 加载失败
+	LocalLoads    int64 // 通过 Getter 加载成功
+	LocalLoadErrs int64 // 通过 Getter 加载失败
+	NegativeHits  int64 // 负缓存命中，直接返回 not-found
+	StaleHits     int64 // 返回了已过期但仍在 stale 窗口内的条目
+	Refreshes     int64 // 触发的后台刷新
+	Evictions     int64 // mainCache 和 hotCache 中被淘汰的条目
+	Bytes         int64 // mainCache 和 hotCache 占用的字节数
+}
+
+func (g *Group) Stats() Stats {
+	main, hot := g.mainCache.stats(), g.hotCache.stats()
+	s := Stats{
+		Gets:          g.stats.gets.Load(),
+		CacheHits:     g.stats.cacheHits.Load(),
+		Loads:         g.stats.loads.Load(),
+		LoadsDeduped:  g.stats.loadsDeduped.Load(),
+		PeerLoads:     g.stats.peerLoads.Load(),
+		PeerErrors:    g.stats.peerErrors.Load(),
+		LocalLoads:    g.stats.localLoads.Load(),
+		LocalLoadErrs: g.stats.localLoadErrs.Load(),
+		NegativeHits:  g.stats.negativeHits.Load(),
+		StaleHits:     g.stats.staleHits.Load(),
+		Refreshes:     g.stats.refreshes.Load(),
+		Evictions:     main.Evictions + hot.Evictions,
+		Bytes:         main.Bytes + hot.Bytes,
+	}
+	s.Dedupes = s.Loads - s.LoadsDeduped
+	return s
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+type metric struct {
+	name, help, typ string
+	value           func(s Stats) int64
+}
+
+var metrics = []metric{
+	{"geecache_gets_total", "Total number of Get requests.", "counter", func(s Stats) int64 { return s.Gets }},
+	{"geecache_cache_hits_total", "Gets served from mainCache or hotCache.", "counter", func(s Stats) int64 { return s.CacheHits }},
+	{"geecache_loads_total", "Gets that missed the cache and required a load.", "counter", func(s Stats) int64 { return s.Loads }},
+	{"geecache_loads_deduped_total", "Loads actually executed after singleflight deduplication.", "counter", func(s Stats) int64 { return s.LoadsDeduped }},
+	{"geecache_singleflight_dedupes_total", "Loads merged into another in-flight load.", "counter", func(s Stats) int64 { return s.Dedupes }},
+	{"geecache_peer_loads_total", "Successful loads from a remote peer.", "counter", func(s Stats) int64 { return s.PeerLoads }},
+	{"geecache_peer_errors_total", "Failed loads from a remote peer.", "counter", func(s Stats) int64 { return s.PeerErrors }},
+	{"geecache_local_loads_total", "Successful loads from the local Getter.", "counter", func(s Stats) int64 { return s.LocalLoads }},
+	{"geecache_local_load_errors_total", "Failed loads from the local Getter.", "counter", func(s Stats) int64 { return s.LocalLoadErrs }},
+	{"geecache_negative_hits_total", "Gets answered with not-found from the negative cache.", "counter", func(s Stats) int64 { return s.NegativeHits }},
+	{"geecache_stale_hits_total", "Gets served from an expired entry within the stale window.", "counter", func(s Stats) int64 { return s.StaleHits }},
+	{"geecache_refreshes_total", "Background refreshes triggered by stale or nearly expired entries.", "counter", func(s Stats) int64 { return s.Refreshes }},
+	{"geecache_evictions_total", "Entries evicted from mainCache and hotCache.", "counter", func(s Stats) int64 { return s.Evictions }},
+	{"geecache_bytes", "Bytes held by mainCache and hotCache.", "gauge", func(s Stats) int64 { return s.Bytes }},
+}
+
+// writeMetrics 以 Prometheus 文本格式输出所有 Group 的统计信息
+func writeMetrics(w io.Writer, gs []*Group) error {
+	stats := make([]Stats, len(gs))
+	for i, g := range gs {
+		stats[i] = g.Stats()
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+			return err
+		}
+		for i, g := range gs {
+			if _, err := fmt.Fprintf(w, "%s{group=%q} %d\n", m.name, g.name, m.value(stats[i])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package twoq
+
+import "container/list"
+
+const (
+	// recentRatio 表示 recent 队列在 maxBytes 中的目标占比
+	recentRatio = 0.25
+	// ghostRatio 表示 ghost 队列中记录的 key 占 maxBytes 的上限比例
+	ghostRatio = 0.5
+)
+
+// Cache 实现 2Q 淘汰策略：新条目先进入 recent 队列，
+// 被再次访问的条目晋升到 frequent 队列，
+// 从 recent 淘汰的 key 会在 ghost 队列中保留一段时间，再次写入时直接进入 frequent
+type Cache struct {
+	maxBytes  int64
+	recent    *queue
+	frequent  *queue
+	ghost     *queue //只记录 key，不占用 nbytes
+	OnEvicted func(key string, value Value)
+}
+
+type Value = interface {
+	Len() int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		recent:    newQueue(),
+		frequent:  newQueue(),
+		ghost:     newQueue(),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if kv, ok := c.frequent.get(key); ok {
+		return kv.value, true
+	}
+	if kv, ok := c.recent.remove(key); ok {
+		c.frequent.push(kv)
+		return kv.value, true
+	}
+	return
+}
+
+func (c *Cache) Add(key string, value Value) {
+	kv := &entry{key: key, value: value}
+	switch {
+	case c.frequent.contains(key):
+		c.frequent.remove(key)
+		c.frequent.push(kv)
+	case c.recent.contains(key):
+		c.recent.remove(key)
+		c.frequent.push(kv)
+	case c.ghost.contains(key):
+		c.ghost.remove(key)
+		c.frequent.push(kv)
+	default:
+		c.recent.push(kv)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.Bytes() {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest 在 recent 超出目标占比时淘汰 recent 中最旧的条目，否则淘汰 frequent 中最旧的条目
+func (c *Cache) RemoveOldest() {
+	if c.recent.len() > 0 && (float64(c.recent.nbytes) > float64(c.maxBytes)*recentRatio || c.frequent.len() == 0) {
+		kv := c.recent.pop()
+		c.ghost.push(&entry{key: kv.key, value: ghostValue{}})
+		for float64(c.ghost.nbytes) > float64(c.maxBytes)*ghostRatio {
+			c.ghost.pop()
+		}
+		c.evicted(kv)
+		return
+	}
+	if kv := c.frequent.pop(); kv != nil {
+		c.evicted(kv)
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	if kv, ok := c.recent.remove(key); ok {
+		c.evicted(kv)
+	} else if kv, ok := c.frequent.remove(key); ok {
+		c.evicted(kv)
+	}
+}
+
+// RemoveIf 删除所有 fn 返回 true 的条目，返回删除的数量
+func (c *Cache) RemoveIf(fn func(key string, value Value) bool) int {
+	n := 0
+	for _, q := range []*queue{c.recent, c.frequent} {
+		for _, kv := range q.removeIf(fn) {
+			c.evicted(kv)
+			n++
+		}
+	}
+	return n
+}
+
+// Range 对每个条目调用 fn，fn 返回 false 时停止，不影响条目的顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for _, q := range []*queue{c.recent, c.frequent} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// SetMaxBytes 修改字节上限，缩小时立即淘汰超出的条目
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.Bytes() {
+		c.RemoveOldest()
+	}
+	for c.maxBytes != 0 && c.ghost.len() > 0 && float64(c.ghost.nbytes) > float64(c.maxBytes)*ghostRatio {
+		c.ghost.pop()
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.recent.len() + c.frequent.len()
+}
+
+// Bytes 返回当前占用的字节数，不包括 ghost 队列
+func (c *Cache) Bytes() int64 {
+	return c.recent.nbytes + c.frequent.nbytes
+}
+
+type ghostValue struct{}
+
+func (ghostValue) Len() int { return 0 }
+
+type entry struct {
+	key   string
+	value Value
+}
+
+// queue 是带字节统计的 LRU 队列，表头为最近访问
+type queue struct {
+	nbytes int64
+	ll     *list.List
+	cache  map[string]*list.Element
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New(), cache: make(map[string]*list.Element)}
+}
+
+func (q *queue) len() int {
+	return q.ll.Len()
+}
+
+func (q *queue) contains(key string) bool {
+	_, ok := q.cache[key]
+	return ok
+}
+
+func (q *queue) get(key string) (*entry, bool) {
+	if ele, ok := q.cache[key]; ok {
+		q.ll.MoveToFront(ele)
+		return ele.Value.(*entry), true
+	}
+	return nil, false
+}
+
+func (q *queue) push(kv *entry) {
+	q.cache[kv.key] = q.ll.PushFront(kv)
+	q.nbytes += int64(len(kv.key)) + int64(kv.value.Len())
+}
+
+func (q *queue) pop() *entry {
+	ele := q.ll.Back()
+	if ele == nil {
+		return nil
+	}
+	return q.removeElement(ele)
+}
+
+func (q *queue) remove(key string) (*entry, bool) {
+	if ele, ok := q.cache[key]; ok {
+		return q.removeElement(ele), true
+	}
+	return nil, false
+}
+
+func (q *queue) removeIf(fn func(key string, value Value) bool) []*entry {
+	var removed []*entry
+	for ele := q.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if kv := ele.Value.(*entry); fn(kv.key, kv.value) {
+			removed = append(removed, q.removeElement(ele))
+		}
+		ele = prev
+	}
+	return removed
+}
+
+func (q *queue) removeElement(ele *list.Element) *entry {
+	q.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(q.cache, kv.key)
+	q.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	return kv
+}
@@ -0,0 +1,67 @@
+package twoq
+
+import (
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	c := New(int64(len("k1v1")*4), nil)
+	c.Add("k1", String("v1"))
+	c.Get("k1")
+	for _, k := range []string{"s1", "s2", "s3", "s4", "s5", "s6"} {
+		c.Add(k, String("vv"))
+	}
+	if _, ok := c.Get("k1"); !ok {
+		t.Fatalf("frequent k1 should survive a scan")
+	}
+	if c.Bytes() > int64(len("k1v1")*4) {
+		t.Fatalf("bytes %d exceed limit", c.Bytes())
+	}
+}
+
+func TestGhostPromotion(t *testing.T) {
+	c := New(int64(len("k1v1")*4), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		c.Add(k, String("vv"))
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("k1 should be evicted from recent")
+	}
+	c.Add("k1", String("vv"))
+	if !c.frequent.contains("k1") {
+		t.Fatalf("k1 in ghost queue should be re-added to frequent")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	c := New(int64(0), func(string, Value) { evicted++ })
+	c.Add("key", String("1"))
+	c.Add("key", String("111"))
+	c.Add("k2", String("22"))
+	c.Remove("k2")
+
+	if c.Bytes() != int64(len("key")+len("111")) || evicted != 1 {
+		t.Fatal("expected 6 but got", c.Bytes())
+	}
+	if n := c.RemoveIf(func(string, Value) bool { return true }); n != 1 || c.Bytes() != 0 {
+		t.Fatalf("RemoveIf expected 1 removed, got %d", n)
+	}
+}
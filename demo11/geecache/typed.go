@@ -0,0 +1,188 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/zsm/demo11/geecache/lru"
+)
+
+// TypedGetterFunc 加载 key 对应的对象，由 TypedGroup 编码后放入缓存
+type TypedGetterFunc[T any] func(ctx context.Context, key string) (T, error)
+
+// TypedGroup 在 Group 之上使用 codec 编解码 T，
+// 设置了 WithObjectCache 时会在本节点缓存解码后的对象，避免重复反序列化
+type TypedGroup[T any] struct {
+	group   *Group
+	codec   Codec[T]
+	mu      sync.Mutex
+	objects *lru.Cache // nil 表示不缓存对象
+	maxObjs int
+}
+
+// objectCacheFraction 表示对象缓存最多占用 Group 字节上限的 1/objectCacheFraction，
+// 上限随 SetCacheBytes 或 Budget 的分配变化
+const objectCacheFraction = 8
+
+// objectEntry 记录对象解码自哪一份缓存数据，数据被替换后对象随之失效
+type objectEntry[T any] struct {
+	b   []byte
+	enc Encoding
+	obj T
+}
+
+// Len 返回条目占用的字节数：保留的编码数据，加上按编码大小估算的解码后对象
+func (e *objectEntry[T]) Len() int {
+	return 2 * len(e.b)
+}
+
+type typedOptions struct {
+	objectCacheItems int
+	groupOpts        []GroupOption
+}
+
+type TypedOption func(*typedOptions)
+
+// WithObjectCache 使 TypedGroup 在本节点最多缓存 maxItems 个解码后的对象，占用的字节数同时受
+// objectCacheFraction 限制。命中时返回的是同一个对象，调用方不应修改它
+func WithObjectCache(maxItems int) TypedOption {
+	return func(o *typedOptions) {
+		o.objectCacheItems = maxItems
+	}
+}
+
+// WithGroupOptions 设置创建底层 Group 时使用的 GroupOption
+func WithGroupOptions(opts ...GroupOption) TypedOption {
+	return func(o *typedOptions) {
+		o.groupOpts = append(o.groupOpts, opts...)
+	}
+}
+
+// NewTypedGroup 在 DefaultRegistry 中创建 TypedGroup，同名的 Group 会被替换，与 NewGroup 相同
+func NewTypedGroup[T any](name string, cacheBytes int64, codec Codec[T], getter TypedGetterFunc[T], opts ...TypedOption) *TypedGroup[T] {
+	t, _ := newTypedGroup(codec, getter, opts, func(getter Getter, groupOpts ...GroupOption) (*Group, error) {
+		return NewGroup(name, cacheBytes, getter, groupOpts...), nil
+	})
+	return t
+}
+
+// NewTypedGroupIn 在 r 中创建 TypedGroup，同名的 Group 已存在时返回 ErrGroupExists，与 Registry.NewGroup 相同
+func NewTypedGroupIn[T any](r *Registry, name string, cacheBytes int64, codec Codec[T], getter TypedGetterFunc[T], opts ...TypedOption) (*TypedGroup[T], error) {
+	return newTypedGroup(codec, getter, opts, func(getter Getter, groupOpts ...GroupOption) (*Group, error) {
+		return r.NewGroup(name, cacheBytes, getter, groupOpts...)
+	})
+}
+
+func newTypedGroup[T any](codec Codec[T], getter TypedGetterFunc[T], opts []TypedOption,
+	newGroup func(Getter, ...GroupOption) (*Group, error)) (*TypedGroup[T], error) {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	var o typedOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	g, err := newGroup(ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		v, err := getter(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	}), o.groupOpts...)
+	if err != nil {
+		return nil, err
+	}
+	t := &TypedGroup[T]{group: g, codec: codec}
+	if o.objectCacheItems > 0 {
+		t.objects = lru.New(0, nil)
+		t.maxObjs = o.objectCacheItems
+	}
+	return t, nil
+}
+
+// Group 返回底层的 Group，用于注册 peer 或查看统计信息
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+func (t *TypedGroup[T]) Get(key string) (T, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+func (t *TypedGroup[T]) GetContext(ctx context.Context, key string) (T, error) {
+	view, err := t.group.GetContext(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if obj, ok := t.lookupObject(key, view); ok {
+		return obj, nil
+	}
+	b, err := view.Bytes()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	obj, err := t.codec.Unmarshal(b)
+	if err != nil {
+		return obj, err
+	}
+	t.addObject(key, view, obj)
+	return obj, nil
+}
+
+func (t *TypedGroup[T]) Set(key string, v T) error {
+	return t.SetContext(context.Background(), key, v)
+}
+
+func (t *TypedGroup[T]) SetContext(ctx context.Context, key string, v T) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.group.SetContext(ctx, key, b)
+}
+
+func (t *TypedGroup[T]) Remove(key string) error {
+	return t.group.RemoveContext(context.Background(), key)
+}
+
+// lookupObject 只有当对象解码自与 view 内容相同的数据时才命中。
+// 从 peer 获取的 value 每次都是新的切片，因此按内容而不是按地址比较，
+// 地址相同时 bytes.Equal 会直接返回
+func (t *TypedGroup[T]) lookupObject(key string, view BytesView) (T, bool) {
+	var zero T
+	if t.objects == nil || len(view.b) == 0 {
+		return zero, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.objects.Get(key)
+	if !ok {
+		return zero, false
+	}
+	e := v.(*objectEntry[T])
+	if e.enc != view.enc || !bytes.Equal(e.b, view.b) {
+		t.objects.Remove(key)
+		return zero, false
+	}
+	return e.obj, true
+}
+
+func (t *TypedGroup[T]) addObject(key string, view BytesView, obj T) {
+	if t.objects == nil || len(view.b) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := &objectEntry[T]{b: view.b, enc: view.enc, obj: obj}
+	maxBytes := t.group.CacheBytes() / objectCacheFraction
+	if maxBytes > 0 && int64(len(key)+e.Len()) > maxBytes {
+		return
+	}
+	t.objects.Add(key, e)
+	for t.objects.Len() > t.maxObjs || maxBytes > 0 && t.objects.Bytes() > maxBytes {
+		t.objects.RemoveOldest()
+	}
+}
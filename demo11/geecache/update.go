@@ -0,0 +1,137 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/zsm/demo11/geecache/geecachepb"
+)
+
+// Set 将 value 写入 key 的所属节点，并清除其他节点上的副本
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := BytesView{b: cloneBytes(value), e: g.expireAt(0)}
+	if peer, ok := g.pickPeer(key); ok {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			return errUnsupported(peer, "Set")
+		}
+		req := &pb.SetRequest{
+			Group:  g.name,
+			Key:    key,
+			Value:  view.b,
+			Expire: expireNano(view.e),
+		}
+		if err := setter.Set(ctx, req, &pb.Ack{}); err != nil {
+			return err
+		}
+		g.Invalidate(key)
+		return nil
+	}
+	g.setLocally(ctx, key, view)
+	return nil
+}
+
+// Remove 删除 key 所属节点上的值，并清除其他节点上的副本
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if peer, ok := g.pickPeer(key); ok {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			return errUnsupported(peer, "Remove")
+		}
+		if err := setter.Remove(ctx, &pb.Request{Group: g.name, Key: key}, &pb.Ack{}); err != nil {
+			return err
+		}
+		g.Invalidate(key)
+		return nil
+	}
+	g.removeLocally(ctx, key)
+	return nil
+}
+
+// Invalidate 只删除本节点上 key 的副本，不通知其他节点
+func (g *Group) Invalidate(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+}
+
+// pickPeer 返回写操作的目标节点，优先使用不受负载影响的 PickOwner
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	if op, ok := g.peers.(OwnerPicker); ok {
+		return op.PickOwner(key)
+	}
+	return g.peers.PickPeer(key)
+}
+
+// setLocally 在所属节点上写入 value，由 SetContext 或 peer 的 Set 请求调用
+func (g *Group) setLocally(ctx context.Context, key string, value BytesView) {
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	g.populateCache(key, value)
+	g.broadcastInvalidate(ctx, key)
+}
+
+// removeLocally 在所属节点上删除 key，由 RemoveContext 或 peer 的 Remove 请求调用
+func (g *Group) removeLocally(ctx context.Context, key string) {
+	g.Invalidate(key)
+	g.broadcastInvalidate(ctx, key)
+}
+
+// broadcastInvalidate 通知其他所有节点删除 key 的副本，失败只记录日志，
+// PeerPicker 未实现 PeerLister 或 peer 未实现 PeerSetter 时跳过
+func (g *Group) broadcastInvalidate(ctx context.Context, key string) {
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return
+	}
+	req := &pb.Request{Group: g.name, Key: key}
+	var wg sync.WaitGroup
+	for _, peer := range lister.GetAll() {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(setter PeerSetter) {
+			defer wg.Done()
+			if err := setter.Invalidate(ctx, req, &pb.Ack{}); err != nil {
+				log.Println("[GeeCache] Failed to invalidate on peer", err)
+			}
+		}(setter)
+	}
+	wg.Wait()
+}
+
+func expireNano(e time.Time) int64 {
+	if e.IsZero() {
+		return 0
+	}
+	return e.UnixNano()
+}
+
+func expireTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/zsm/demo11/geecache"
 )
@@ -22,56 +32,154 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
+		}), geecache.WithNegativeTTL(10*time.Second))
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
+// warmStart 在加入哈希环之前从快照文件或其他节点载入缓存，
+// src 以 http:// 开头时通过 peers 从该节点的 admin 接口拉取快照，请求会带上本节点的签名
+func warmStart(src string, peers *geecache.HTTPPool, gee *geecache.Group) {
+	var n int
+	var err error
+	switch {
+	case !strings.HasPrefix(src, "http://"):
+		n, err = gee.LoadSnapshot(src)
+	case peers == nil:
+		err = fmt.Errorf("warming from a peer requires the HTTP transport")
+	default:
+		n, err = peers.LoadSnapshotFrom(context.Background(), src, gee)
+	}
+	if err != nil {
+		log.Println("warm start from", src, "failed:", err)
+		return
+	}
+	log.Println("warm start loaded", n, "entries from", src)
+}
+
+func newHTTPPool(addr string, addrs []string, secret string) *geecache.HTTPPool {
+	var opts []geecache.HTTPPoolOption
+	if secret != "" {
+		opts = append(opts, geecache.WithHMAC([]byte(secret)))
+	}
+	peers := geecache.NewHTTPPool(addr, opts...)
 	peers.Set(addrs...)
+	return peers
+}
+
+func startCacheServer(addr string, peers *geecache.HTTPPool, gee *geecache.Group) {
+	peers.StartHealthCheck(5 * time.Second)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	log.Fatal(http.ListenAndServe(hostPort(addr), peers))
+}
+
+// hostPort 返回 http://host:port 形式地址中的 host:port，用于监听和 gRPC
+func hostPort(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		log.Fatalf("invalid address %q, expected http://host:port", addr)
+	}
+	return u.Host
+}
+
+func startGRPCCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	self := hostPort(addr)
+	peerAddrs := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		peerAddrs = append(peerAddrs, hostPort(a))
+	}
+	peers := geecache.NewGRPCPool(self)
+	peers.Set(peerAddrs...)
+	gee.RegisterPeers(peers)
+	lis, err := net.Listen("tcp", self)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("geecache(gRPC) is shutting down")
+		peers.GracefulStop()
+	}()
+	log.Println("geecache(gRPC) is running at", self)
+	if err := peers.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.GetContext(r.Context(), key)
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			var b []byte
+			if err == nil {
+				b, err = view.Bytes()
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			w.Header().Set("Content-Type", "application/octet-stream")
-			w.Write(view.ByteSlice())
+			w.Write(b)
 		}))
 	log.Println("fontend server is running on", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	log.Fatal(http.ListenAndServe(hostPort(apiAddr), nil))
 }
 
 func main() {
 	var port int
 	var api bool
+	var useGRPC bool
+	var warm string
+	var secret string
+	var peerList string
+	var self string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.BoolVar(&useGRPC, "grpc", false, "Use gRPC between peers?")
+	flag.StringVar(&warm, "warm", "", "Warm the cache from a snapshot file or peer address before serving")
+	flag.StringVar(&secret, "secret", "", "Shared secret used to sign requests between peers")
+	flag.StringVar(&self, "self", "", "Address of this node as listed in -peers, defaults to http://localhost:<port>")
+	flag.StringVar(&peerList, "peers", "http://localhost:8001,http://localhost:8002,http://localhost:8003",
+		"Comma-separated addresses of all peers, including this one; more can be added at runtime via /_geecache/_admin/peers when -secret is set")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	addr := self
+	if addr == "" {
+		addr = fmt.Sprintf("http://localhost:%d", port)
 	}
-
 	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
-	} 
+	for _, a := range strings.Split(peerList, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	// 本节点必须以同样的地址出现在 -peers 中，否则会把自己的 key 转发给自己
+	if !slices.Contains(addrs, addr) {
+		log.Fatalf("-self %s is not listed in -peers %s", addr, peerList)
+	}
 
 	gee := createGroup()
+	var peers *geecache.HTTPPool
+	if !useGRPC {
+		peers = newHTTPPool(addr, addrs, secret)
+	}
+	if warm != "" {
+		warmStart(warm, peers, gee)
+	}
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	if useGRPC {
+		startGRPCCacheServer(addr, addrs, gee)
+		return
+	}
+	startCacheServer(addr, peers, gee)
 }